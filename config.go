@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nixihz/recutils-mcp/recutils"
+	"github.com/nixihz/recutils-mcp/server"
+)
+
+// config Command line configuration shared by the server and doctor
+type config struct {
+	roots          []string                 // allowed database root directories
+	readOnly       bool                     // only offer query tools
+	lockTimeout    time.Duration            // wait for locked databases
+	commandTimeout time.Duration            // limit of a single recutils command
+	toolTimeouts   map[string]time.Duration // per-tool command timeouts
+	binDir         string                   // recutils binaries instead of PATH
+	transport      server.Transport         // stdio, http or sse
+	listenAddr     string                   // address of the http and sse transports
+	authFile       string                   // bearer tokens of the http and sse transports
+}
+
+// parseFlags Parse the command line flags of the named command
+func parseFlags(name string, args []string) (*config, error) {
+	cfg := &config{toolTimeouts: map[string]time.Duration{}, transport: server.TransportStdio}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	// Database files are confined to these directories when any is given
+	fs.Func("root", "allowed database root directory (repeatable)", func(dir string) error {
+		cfg.roots = append(cfg.roots, dir)
+		return nil
+	})
+	// Read-only mode can also be enabled with RECUTILS_MCP_READ_ONLY=1
+	readOnlyDefault, _ := strconv.ParseBool(os.Getenv("RECUTILS_MCP_READ_ONLY"))
+	fs.BoolVar(&cfg.readOnly, "read-only", readOnlyDefault, "only offer query tools and reject every mutation")
+	fs.DurationVar(&cfg.lockTimeout, "lock-timeout", recutils.DefaultLockTimeout, "how long to wait for a locked database before reporting it busy")
+	fs.DurationVar(&cfg.commandTimeout, "command-timeout", recutils.DefaultCommandTimeout, "how long a single recutils command may run, 0 for no limit")
+	// Per-tool overrides of the command timeout, e.g. recutils_aggregate=2m
+	fs.Func("tool-timeout", "command timeout of one tool as name=duration (repeatable)", func(value string) error {
+		tool, duration, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("expected name=duration, got %q", value)
+		}
+		timeout, err := time.ParseDuration(duration)
+		if err != nil {
+			return err
+		}
+		cfg.toolTimeouts[tool] = timeout
+		return nil
+	})
+	fs.StringVar(&cfg.binDir, "bin-dir", "", "directory of the recutils binaries to use instead of PATH")
+	fs.Func("transport", "how clients connect: stdio (default), http (streamable HTTP) or sse", func(name string) error {
+		transport, err := server.ParseTransport(name)
+		cfg.transport = transport
+		return err
+	})
+	fs.StringVar(&cfg.listenAddr, "listen", "127.0.0.1:8080", "address the http and sse transports listen on")
+	fs.StringVar(&cfg.authFile, "auth-file", "", "JSON file of bearer tokens required by the http and sse transports")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return cfg, nil
+}
+
+// authenticator Authenticator of the tokens in the auth file and in
+// RECUTILS_MCP_TOKENS, nil when neither is set
+func (cfg *config) authenticator() (*server.Authenticator, error) {
+	var tokens []server.Token
+	if cfg.authFile != "" {
+		fileTokens, err := server.LoadTokens(cfg.authFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+	if env := os.Getenv("RECUTILS_MCP_TOKENS"); env != "" {
+		envTokens, err := server.ParseTokens([]byte(env))
+		if err != nil {
+			return nil, fmt.Errorf("RECUTILS_MCP_TOKENS: %w", err)
+		}
+		tokens = append(tokens, envTokens...)
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return server.NewAuthenticator(tokens)
+}
+
+// recordOptions Record operation options of the configuration
+func (cfg *config) recordOptions() []recutils.Option {
+	opts := []recutils.Option{
+		recutils.WithRoots(cfg.roots...),
+		recutils.WithLockTimeout(cfg.lockTimeout),
+		recutils.WithCommandTimeout(cfg.commandTimeout),
+	}
+	if cfg.binDir != "" {
+		opts = append(opts, recutils.WithBinDir(cfg.binDir))
+	}
+	if cfg.readOnly {
+		opts = append(opts, recutils.WithReadOnly())
+	}
+	return opts
+}
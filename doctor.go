@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// installHint How to fix missing recutils binaries
+const installHint = "Install GNU recutils (e.g. `apt install recutils` or `brew install recutils`) " +
+	"or point --bin-dir at the directory containing its binaries."
+
+// report Outcome of the self-check
+type report struct {
+	binaries []recutils.BinaryStatus
+	roots    []recutils.RootStatus
+	logDir   string
+	logError string
+}
+
+// selfCheck Check the recutils binaries, the log directory and the roots
+func selfCheck(ctx context.Context, op *recutils.RecordOperation) *report {
+	r := &report{
+		binaries: op.CheckBinaries(ctx),
+		roots:    op.CheckRoots(),
+		logDir:   filepath.Dir(getLogFilePath()),
+	}
+	if err := checkLogDir(r.logDir); err != nil {
+		r.logError = err.Error()
+	}
+	return r
+}
+
+// checkLogDir Check that the log directory exists or can be created, and
+// is writable
+func checkLogDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".recutils-mcp-check-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// missingRequired Names of the required binaries that are not usable
+func (r *report) missingRequired() []string {
+	var missing []string
+	for _, b := range r.binaries {
+		if b.Required && b.Error != "" {
+			missing = append(missing, b.Name)
+		}
+	}
+	return missing
+}
+
+// problems Actionable descriptions of everything that keeps the server
+// from working
+func (r *report) problems() []string {
+	var problems []string
+	if missing := r.missingRequired(); len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("recutils binaries not found or not working: %s. %s",
+			strings.Join(missing, ", "), installHint))
+	}
+	for _, root := range r.roots {
+		if root.Error != "" {
+			problems = append(problems, fmt.Sprintf("root directory %s is not usable: %s", root.Path, root.Error))
+		}
+	}
+	if r.logError != "" {
+		problems = append(problems, fmt.Sprintf("log directory %s is not usable: %s", r.logDir, r.logError))
+	}
+	return problems
+}
+
+// print Write the report in human readable form
+func (r *report) print(w io.Writer) {
+	fmt.Fprintln(w, "recutils binaries:")
+	for _, b := range r.binaries {
+		state := "ok"
+		detail := b.Path + "  " + b.Version
+		if b.Error != "" {
+			state = "MISSING"
+			if !b.Required {
+				state = "optional"
+			}
+			detail = b.Error
+		}
+		fmt.Fprintf(w, "  %-8s %-8s %s\n", state, b.Name, strings.TrimSpace(detail))
+	}
+
+	fmt.Fprintln(w, "log directory:")
+	if r.logError != "" {
+		fmt.Fprintf(w, "  %-8s %s: %s\n", "ERROR", r.logDir, r.logError)
+	} else {
+		fmt.Fprintf(w, "  %-8s %s\n", "ok", r.logDir)
+	}
+
+	fmt.Fprintln(w, "root directories:")
+	if len(r.roots) == 0 {
+		fmt.Fprintln(w, "  none configured, any path is allowed")
+	}
+	for _, root := range r.roots {
+		if root.Error != "" {
+			fmt.Fprintf(w, "  %-8s %s: %s\n", "ERROR", root.Path, root.Error)
+		} else {
+			fmt.Fprintf(w, "  %-8s %s\n", "ok", root.Path)
+		}
+	}
+}
+
+// runDoctor Print the self-check report and return the exit status
+func runDoctor(ctx context.Context, w io.Writer, cfg *config) int {
+	r := selfCheck(ctx, recutils.NewRecordOperation(cfg.recordOptions()...))
+	r.print(w)
+
+	problems := r.problems()
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "\nEverything looks good.")
+		return 0
+	}
+	fmt.Fprintln(w, "\nProblems:")
+	for _, problem := range problems {
+		fmt.Fprintf(w, "  - %s\n", problem)
+	}
+	return 1
+}
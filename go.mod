@@ -2,9 +2,13 @@ module github.com/nixihz/recutils-mcp
 
 go 1.24
 
-require github.com/modelcontextprotocol/go-sdk v0.6.0
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/modelcontextprotocol/go-sdk v0.6.0
+)
 
 require (
 	github.com/google/jsonschema-go v0.2.3 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
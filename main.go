@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"path/filepath"
 	"syscall"
 
+	"github.com/nixihz/recutils-mcp/recutils"
 	"github.com/nixihz/recutils-mcp/server"
 )
 
@@ -44,6 +47,13 @@ func initLogging() (*os.File, error) {
 }
 
 func main() {
+	// recutils-mcp doctor: report the state of the installation and exit
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		cfg := mustParseFlags("recutils-mcp doctor", os.Args[2:])
+		os.Exit(runDoctor(context.Background(), os.Stdout, cfg))
+	}
+	cfg := mustParseFlags("recutils-mcp", os.Args[1:])
+
 	// 初始化日志
 	logFile, err := initLogging()
 	if err != nil {
@@ -56,8 +66,24 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Fail fast instead of answering every tool call with an exec error
+	startupCheck(ctx, cfg)
+
 	// Create MCP server
-	srv := server.NewMCPServer()
+	srv := server.NewMCPServer(cfg.recordOptions()...)
+	for tool, timeout := range cfg.toolTimeouts {
+		srv.SetToolTimeout(tool, timeout)
+	}
+
+	// Bearer tokens only apply to the network transports
+	auth, err := cfg.authenticator()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recutils-mcp: %v\n", err)
+		os.Exit(2)
+	}
+	if auth != nil {
+		srv.SetAuthenticator(auth)
+	}
 
 	// Handle signals for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -71,9 +97,61 @@ func main() {
 
 	// Run server
 	log.Println("Starting Recutils MCP Server...")
+	if len(cfg.roots) > 0 {
+		log.Printf("Database root directories: %v\n", cfg.roots)
+	}
+	if cfg.readOnly {
+		log.Println("Read-only mode: mutation tools are disabled")
+	}
 
-	if err := srv.Run(ctx); err != nil {
+	if cfg.transport != server.TransportStdio && auth == nil {
+		log.Printf("No bearer tokens configured: every client reaching %s has full access\n", cfg.listenAddr)
+	}
+
+	if cfg.transport == server.TransportStdio {
+		err = srv.Run(ctx)
+	} else {
+		err = srv.ListenAndServe(ctx, cfg.transport, cfg.listenAddr)
+	}
+	if err != nil {
 		log.Printf("Server error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// mustParseFlags Parse flags or exit, successfully for -h
+func mustParseFlags(name string, args []string) *config {
+	cfg, err := parseFlags(name, args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(2)
+	}
+	return cfg
+}
+
+// startupCheck Log the recutils installation and exit when the server
+// could not work
+func startupCheck(ctx context.Context, cfg *config) {
+	r := selfCheck(ctx, recutils.NewRecordOperation(cfg.recordOptions()...))
+	for _, b := range r.binaries {
+		if b.Error != "" {
+			log.Printf("recutils binary %s unavailable: %s\n", b.Name, b.Error)
+		} else {
+			log.Printf("Found %s: %s\n", b.Path, b.Version)
+		}
+	}
+
+	problems := r.problems()
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		log.Println(problem)
+		fmt.Fprintf(os.Stderr, "recutils-mcp: %s\n", problem)
+	}
+	fmt.Fprintln(os.Stderr, "Run `recutils-mcp doctor` for details.")
+	os.Exit(1)
+}
@@ -0,0 +1,139 @@
+// recutils package: Aggregate reports computed by recsel
+package recutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// aggregateFunctions Aggregate functions supported by recsel, keyed by
+// lower-case name
+var aggregateFunctions = map[string]string{
+	"count": "Count",
+	"sum":   "Sum",
+	"avg":   "Avg",
+	"min":   "Min",
+	"max":   "Max",
+}
+
+// AggregateSpec Single aggregate column, e.g. Sum(Hours)
+type AggregateSpec struct {
+	Function string `json:"function"`        // Count, Sum, Avg, Min or Max
+	Field    string `json:"field"`           // field the function is applied to
+	Alias    string `json:"alias,omitempty"` // column name, defaults to Function_Field
+}
+
+// AggregateOptions Options of an aggregate report
+type AggregateOptions struct {
+	Selection
+	GroupBy    []string
+	Aggregates []AggregateSpec
+}
+
+// Column Typed column of a table
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // string, integer or number
+}
+
+// Table Typed tabular result of a report. Cells of string columns hold
+// strings, cells of integer and number columns hold numbers, or null when
+// recsel produced no numeric value.
+type Table struct {
+	Columns []Column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// Aggregate Compute aggregate functions over the selected records, optionally
+// grouped by some fields, and return them as a typed table
+func (ro *RecordOperation) Aggregate(ctx context.Context, databaseFile string, opts AggregateOptions) (*Result, error) {
+	if len(opts.Aggregates) == 0 {
+		return &Result{Success: false, Output: "", Error: "at least one aggregate is required"}, nil
+	}
+
+	columns := make([]Column, 0, len(opts.GroupBy)+len(opts.Aggregates))
+	sources := make([]string, 0, cap(columns)) // recsel output field of each column
+	fields := append([]string{}, opts.GroupBy...)
+	for _, name := range opts.GroupBy {
+		if !IsValidFieldName(name) {
+			return &Result{Success: false, Output: "", Error: fmt.Sprintf("invalid group by field %q", name)}, nil
+		}
+		columns = append(columns, Column{Name: name, Type: "string"})
+		sources = append(sources, name)
+	}
+
+	for _, spec := range opts.Aggregates {
+		function, ok := aggregateFunctions[strings.ToLower(spec.Function)]
+		if !ok {
+			return &Result{Success: false, Output: "", Error: fmt.Sprintf("unknown aggregate function %q", spec.Function)}, nil
+		}
+		if !IsValidFieldName(spec.Field) {
+			return &Result{Success: false, Output: "", Error: fmt.Sprintf("invalid aggregate field %q", spec.Field)}, nil
+		}
+
+		// recsel names aggregate output fields Function_Field
+		source := function + "_" + spec.Field
+		name := spec.Alias
+		if name == "" {
+			name = source
+		}
+		columnType := "number"
+		if function == "Count" {
+			columnType = "integer"
+		}
+
+		fields = append(fields, fmt.Sprintf("%s(%s)", function, spec.Field))
+		columns = append(columns, Column{Name: name, Type: columnType})
+		sources = append(sources, source)
+	}
+
+	result, err := ro.QueryRecordsWithOptions(ctx, databaseFile, QueryOptions{
+		Selection:  opts.Selection,
+		Fields:     fields,
+		GroupBy:    opts.GroupBy,
+		Structured: true,
+	})
+	if err != nil || !result.Success {
+		return result, err
+	}
+
+	table := &Table{Columns: columns, Rows: [][]any{}}
+	for _, record := range result.Records {
+		row := make([]any, len(columns))
+		for i, column := range columns {
+			var value string
+			if values := record[sources[i]]; len(values) > 0 {
+				value = values[0]
+			}
+			row[i] = typedValue(column.Type, value)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return &Result{
+		Success: true,
+		Output:  "",
+		Error:   result.Error,
+		Table:   table,
+	}, nil
+}
+
+// typedValue Convert a recsel output value to the JSON type of its column
+func typedValue(columnType, value string) any {
+	switch columnType {
+	case "integer":
+		if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return n
+		}
+		return nil
+	case "number":
+		if n, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return n
+		}
+		return nil
+	default:
+		return value
+	}
+}
@@ -0,0 +1,108 @@
+// recutils package: Unit tests for aggregate reports
+package recutils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestAggregateValidation tests aggregate specs rejected before running recsel
+func TestAggregateValidation(t *testing.T) {
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opts AggregateOptions
+	}{
+		{name: "No aggregates", opts: AggregateOptions{}},
+		{name: "Unknown function", opts: AggregateOptions{Aggregates: []AggregateSpec{{Function: "Median", Field: "Hours"}}}},
+		{name: "Invalid field", opts: AggregateOptions{Aggregates: []AggregateSpec{{Function: "Sum", Field: "Hours)"}}}},
+		{name: "Invalid group by field", opts: AggregateOptions{
+			GroupBy:    []string{"Project,Name"},
+			Aggregates: []AggregateSpec{{Function: "Count", Field: "Name"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := op.Aggregate(ctx, "test.rec", tt.opts)
+			if err != nil || result == nil || result.Success {
+				t.Errorf("Expected failed result, got %+v, %v", result, err)
+			}
+		})
+	}
+}
+
+// TestTypedValue tests converting recsel values to typed cells
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		columnType string
+		value      string
+		want       any
+	}{
+		{"integer", "3", int64(3)},
+		{"integer", "", nil},
+		{"number", "2.5", 2.5},
+		{"number", "7", 7.0},
+		{"number", "n/a", nil},
+		{"string", "Boston", "Boston"},
+	}
+
+	for _, tt := range tests {
+		if got := typedValue(tt.columnType, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("typedValue(%q, %q) = %#v, want %#v", tt.columnType, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestAggregate tests aggregate reports against a real database
+func TestAggregate(t *testing.T) {
+	if _, err := exec.LookPath("recsel"); err != nil {
+		t.Skip("recutils not installed, skipping test")
+	}
+
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	testDBPath := filepath.Join(t.TempDir(), "test_aggregate.rec")
+	testData := `%rec: Task
+
+Project: alpha
+Hours: 2
+
+Project: beta
+Hours: 5
+
+Project: alpha
+Hours: 3
+`
+	if err := os.WriteFile(testDBPath, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	result, err := op.Aggregate(ctx, testDBPath, AggregateOptions{
+		Selection: Selection{RecordType: "Task"},
+		GroupBy:   []string{"Project"},
+		Aggregates: []AggregateSpec{
+			{Function: "sum", Field: "Hours", Alias: "Total"},
+			{Function: "Count", Field: "Hours"},
+		},
+	})
+	if err != nil || result == nil || !result.Success || result.Table == nil {
+		t.Fatalf("Aggregate failed: %v, result: %+v", err, result)
+	}
+
+	wantColumns := []Column{{"Project", "string"}, {"Total", "number"}, {"Count_Hours", "integer"}}
+	if !reflect.DeepEqual(result.Table.Columns, wantColumns) {
+		t.Errorf("Expected columns %v, got %v", wantColumns, result.Table.Columns)
+	}
+	wantRows := [][]any{{"alpha", 5.0, int64(2)}, {"beta", 5.0, int64(1)}}
+	if !reflect.DeepEqual(result.Table.Rows, wantRows) {
+		t.Errorf("Expected rows %v, got %v", wantRows, result.Table.Rows)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+// recutils package: File ownership on systems without Unix owners
+package recutils
+
+import "os"
+
+// chownLike File ownership is not preserved on this platform
+func chownLike(f *os.File, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,139 @@
+// recutils package: Unit tests for atomic database file writes
+package recutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteFileAtomic tests replacing files through a temp file
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("Replace keeps mode", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "db.rec")
+		if err := os.WriteFile(path, []byte("Name: old\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, 0640); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeFileAtomic(path, []byte("Name: new\n"), 0644); err != nil {
+			t.Fatalf("writeFileAtomic failed: %v", err)
+		}
+
+		content, _ := os.ReadFile(path)
+		if string(content) != "Name: new\n" {
+			t.Errorf("Unexpected content %q", content)
+		}
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("Expected mode 0640, got %v", info.Mode().Perm())
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("New file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "db.rec")
+
+		if err := writeFileAtomic(path, []byte("Name: new\n"), 0644); err != nil {
+			t.Fatalf("writeFileAtomic failed: %v", err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.Mode().Perm() != 0644 {
+			t.Errorf("Expected new file with mode 0644, got %v, %v", info, err)
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("Symlink is kept", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "real.rec")
+		link := filepath.Join(dir, "link.rec")
+		if err := os.WriteFile(target, []byte("Name: old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeFileAtomic(link, []byte("Name: new\n"), 0644); err != nil {
+			t.Fatalf("writeFileAtomic failed: %v", err)
+		}
+
+		if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+			t.Error("Symlink was replaced by a regular file")
+		}
+		if content, _ := os.ReadFile(target); string(content) != "Name: new\n" {
+			t.Errorf("Link target not updated: %q", content)
+		}
+	})
+
+	t.Run("Missing directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "db.rec")
+		if err := writeFileAtomic(path, []byte("Name: new\n"), 0644); err == nil {
+			t.Error("Expected error but got none")
+		}
+	})
+}
+
+// TestUpdateRecordsAtomic tests that native rewrites leave no backup or temp files
+func TestUpdateRecordsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.rec")
+	if err := os.WriteFile(path, []byte("%rec: Person\n\nName: John\nAge: 25\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Parse(mustOpen(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RecordSets[0].Records[0].Set("Age", "26")
+	if err := writeDatabase(path, db); err != nil {
+		t.Fatalf("writeDatabase failed: %v", err)
+	}
+
+	if content, _ := os.ReadFile(path); string(content) != "%rec: Person\n\nName: John\nAge: 26\n" {
+		t.Errorf("Unexpected content %q", content)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	assertNoTempFiles(t, dir)
+
+	// Inserting into a new file goes through the same path
+	op := NewRecordOperation(passRecfix)
+	newPath := filepath.Join(dir, "new.rec")
+	result, err := op.InsertRecord(context.Background(), newPath, "Person", map[string]interface{}{"Name": "Jane"})
+	if err != nil || !result.Success {
+		t.Fatalf("InsertRecord failed: %v, %+v", err, result)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// assertNoTempFiles Fail if dir holds anything but database files
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".rec" {
+			t.Errorf("Unexpected leftover file %s", e.Name())
+		}
+	}
+}
+
+// mustOpen Open a file for the duration of the test
+func mustOpen(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+// recutils package: File ownership on Unix systems
+package recutils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// chownLike Give f the owner and group of the file described by info. Only
+// privileged processes can give files away, so a refused change is ignored
+// when the owner already matches the current user.
+func chownLike(f *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := f.Chown(int(stat.Uid), int(stat.Gid))
+	if errors.Is(err, os.ErrPermission) && int(stat.Uid) == os.Getuid() {
+		// Not a member of the original group, keep the default group
+		return nil
+	}
+	return err
+}
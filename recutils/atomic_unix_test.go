@@ -0,0 +1,39 @@
+//go:build unix
+
+// recutils package: Unit tests for file ownership on Unix systems
+package recutils
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestWriteFileAtomicOwner tests that replaced files keep their owner
+func TestWriteFileAtomicOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing file owners requires root")
+	}
+
+	path := filepath.Join(t.TempDir(), "db.rec")
+	if err := os.WriteFile(path, []byte("Name: old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Skipf("chown not supported: %v", err)
+	}
+
+	if err := writeFileAtomic(path, []byte("Name: new\n"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Uid != 1234 || stat.Gid != 5678 {
+		t.Errorf("Expected owner 1234:5678, got %d:%d", stat.Uid, stat.Gid)
+	}
+}
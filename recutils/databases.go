@@ -0,0 +1,98 @@
+// recutils package: Discover and read database files
+package recutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DatabaseExt File name extension of database files
+const DatabaseExt = ".rec"
+
+// ListDatabases List the database files below the configured roots. Files
+// below the first root are returned relative to it, like database paths are
+// given to the other operations; files below other roots are absolute.
+// Hidden files and directories, such as the temp files of atomic writes, are
+// skipped. Without roots there is nothing to list.
+func (ro *RecordOperation) ListDatabases() ([]string, error) {
+	if len(ro.roots) == 0 {
+		return nil, nil
+	}
+	firstRoot, err := evalExistingSymlinks(ro.roots[0])
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var databases []string
+	for _, root := range ro.roots {
+		realRoot, err := evalExistingSymlinks(root)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(realRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// A missing root has no databases yet
+				if path == realRoot && errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if path != realRoot && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || filepath.Ext(path) != DatabaseExt {
+				return nil
+			}
+
+			name := path
+			if rel, err := filepath.Rel(firstRoot, path); err == nil && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				name = rel
+			}
+			if !seen[name] {
+				seen[name] = true
+				databases = append(databases, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
+	}
+	sort.Strings(databases)
+	return databases, nil
+}
+
+// ReadDatabase Parse a database file under a shared lock
+func (ro *RecordOperation) ReadDatabase(ctx context.Context, databaseFile string) (*Database, error) {
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockShared, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	content, err := os.ReadFile(databaseFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database file: %w", err)
+	}
+	db, err := Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database file: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,88 @@
+// recutils package: Unit tests for database discovery and reading
+package recutils
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestListDatabases tests listing the databases below the roots
+func TestListDatabases(t *testing.T) {
+	root := t.TempDir()
+	other := t.TempDir()
+	realOther, _ := filepath.EvalSymlinks(other)
+
+	files := []string{
+		filepath.Join(root, "people.rec"),
+		filepath.Join(root, "projects", "2026.rec"),
+		filepath.Join(root, "notes.txt"),
+		filepath.Join(root, ".people.rec.tmp-123"),
+		filepath.Join(root, ".git", "config.rec"),
+		filepath.Join(other, "shared.rec"),
+	}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	databases, err := NewRecordOperation(WithRoots(root, other, filepath.Join(root, "missing"))).ListDatabases()
+	if err != nil {
+		t.Fatalf("ListDatabases failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(realOther, "shared.rec"),
+		"people.rec",
+		filepath.Join("projects", "2026.rec"),
+	}
+	if !reflect.DeepEqual(databases, want) {
+		t.Errorf("Expected %v, got %v", want, databases)
+	}
+
+	if databases, err := NewRecordOperation().ListDatabases(); err != nil || len(databases) != 0 {
+		t.Errorf("Expected no databases without roots, got %v, %v", databases, err)
+	}
+}
+
+// TestReadDatabase tests reading and parsing a database file
+func TestReadDatabase(t *testing.T) {
+	root := t.TempDir()
+	content := "%rec: Person\n%key: Id\n\nId: 1\nName: John Doe\n\nId: 2\nName: Jane Doe\n"
+	if err := os.WriteFile(filepath.Join(root, "people.rec"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	op := NewRecordOperation(WithRoots(root))
+
+	db, err := op.ReadDatabase(context.Background(), "people.rec")
+	if err != nil {
+		t.Fatalf("ReadDatabase failed: %v", err)
+	}
+	if db.String() != content {
+		t.Errorf("Expected content %q, got %q", content, db.String())
+	}
+	rs := db.RecordSet("Person")
+	if rs == nil || rs.Key() != "Id" {
+		t.Fatalf("Expected Person record set keyed by Id")
+	}
+	if r := rs.Lookup("2"); r == nil || r.String() != "Id: 2\nName: Jane Doe\n" {
+		t.Errorf("Unexpected record %v", r)
+	}
+	if r := rs.Lookup("3"); r != nil {
+		t.Errorf("Expected no record for a missing key, got %v", r)
+	}
+
+	if _, err := op.ReadDatabase(context.Background(), "missing.rec"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+	if _, err := op.ReadDatabase(context.Background(), filepath.Join(t.TempDir(), "people.rec")); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("Expected root violation, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+// recutils package: Create, alter and drop record types
+package recutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DescriptorAction Kind of change made to a descriptor field
+type DescriptorAction string
+
+const (
+	DescriptorSet    DescriptorAction = "set"    // replace every field of the name with one field
+	DescriptorAdd    DescriptorAction = "add"    // add another field of the name
+	DescriptorRemove DescriptorAction = "remove" // remove fields or list entries of the name
+)
+
+// descriptorFields Special fields that can be changed, see DescriptorChange
+var descriptorFields = map[string]bool{
+	"%doc": true, "%key": true, "%mandatory": true, "%allowed": true,
+	"%prohibit": true, "%unique": true, "%auto": true, "%sort": true,
+	"%confidential": true, "%size": true, "%constraint": true,
+	"%type": true, "%typedef": true, "%singular": true,
+}
+
+// listFields Special fields whose value is a list of field names
+var listFields = map[string]bool{
+	"%mandatory": true, "%allowed": true, "%prohibit": true, "%unique": true,
+	"%auto": true, "%sort": true, "%confidential": true, "%singular": true,
+}
+
+// DescriptorChange Change of one special field of a record descriptor, e.g.
+// {add %type "Age int"}. Remove without a value removes every field of the
+// name. With a value it removes the fields with exactly that value, the
+// value from list fields such as %mandatory, the field from the field list
+// of %type, and the typedef of that name from %typedef.
+type DescriptorChange struct {
+	Action DescriptorAction `json:"action"`          // set, add or remove
+	Field  string           `json:"field"`           // special field, e.g. %key; the % is optional
+	Value  string           `json:"value,omitempty"` // field value
+}
+
+// apply Apply the change to a descriptor
+func (c DescriptorChange) apply(desc *Record) error {
+	name := c.Field
+	if !strings.HasPrefix(name, "%") {
+		name = "%" + name
+	}
+	if !descriptorFields[name] {
+		return fmt.Errorf("%s cannot be changed, expected one of %%doc, %%key, %%mandatory, %%allowed, "+
+			"%%prohibit, %%unique, %%auto, %%sort, %%confidential, %%size, %%constraint, %%type, %%typedef or %%singular", c.Field)
+	}
+	value := strings.TrimSpace(c.Value)
+
+	switch c.Action {
+	case DescriptorSet, DescriptorAdd:
+		if value == "" {
+			return fmt.Errorf("%s %s requires a value", c.Action, name)
+		}
+		if c.Action == DescriptorSet {
+			desc.Set(name, value)
+			// Set keeps every field of the name, drop all but the first
+			first := true
+			desc.removeFields(func(f *Field) bool {
+				if f.Name != name {
+					return false
+				}
+				keep := first
+				first = false
+				return !keep
+			})
+			return nil
+		}
+		desc.insertField(NewField(name, value))
+	case DescriptorRemove:
+		removeDescriptorValue(desc, name, value)
+	default:
+		return fmt.Errorf("unknown action %q, expected set, add or remove", c.Action)
+	}
+	return nil
+}
+
+// removeDescriptorValue Remove fields or list entries, see DescriptorChange
+func removeDescriptorValue(desc *Record, name, value string) {
+	desc.removeFields(func(f *Field) bool {
+		if f.Name != name {
+			return false
+		}
+		current := strings.TrimSpace(f.Value)
+		if value == "" || current == value {
+			return true
+		}
+
+		switch {
+		case listFields[name]:
+			var kept []string
+			for _, word := range strings.Fields(current) {
+				if word != value {
+					kept = append(kept, word)
+				}
+			}
+			f.Value = strings.Join(kept, " ")
+			return len(kept) == 0
+		case name == "%typedef":
+			return firstWord(current) == value
+		case name == "%type":
+			fieldList, description, _ := cutWord(current)
+			var kept []string
+			for _, field := range strings.Split(fieldList, ",") {
+				if field = strings.TrimSpace(field); field != "" && field != value {
+					kept = append(kept, field)
+				}
+			}
+			if len(kept) > 0 {
+				f.Value = strings.Join(kept, ",") + " " + description
+			}
+			return len(kept) == 0
+		}
+		return false
+	})
+}
+
+// removeFields Remove the fields for which remove returns true
+func (r *Record) removeFields(remove func(*Field) bool) {
+	kept := r.Fields[:0]
+	for _, f := range r.Fields {
+		if !remove(f) {
+			kept = append(kept, f)
+		}
+	}
+	r.Fields = kept
+}
+
+// insertField Add a field after the last field of the same name, or at the
+// end if there is none
+func (r *Record) insertField(field *Field) {
+	at := len(r.Fields)
+	for i, f := range r.Fields {
+		if f.Name == field.Name {
+			at = i + 1
+		}
+	}
+	r.Fields = append(r.Fields[:at], append([]*Field{field}, r.Fields[at:]...)...)
+}
+
+// CreateType Add a record set with a new descriptor for recordType, shaped by
+// the changes. The database is created if it does not exist.
+func (ro *RecordOperation) CreateType(ctx context.Context, databaseFile, recordType string, changes []DescriptorChange) (*Result, error) {
+	if result, err := ro.checkWritable("CreateType"); err != nil {
+		return result, err
+	}
+	if !IsValidFieldName(recordType) || strings.HasPrefix(recordType, "%") {
+		return failedResult(fmt.Errorf("invalid record type %q", recordType))
+	}
+
+	return ro.editDescriptors(ctx, databaseFile, true, func(db *Database) (string, error) {
+		if db.RecordSet(recordType) != nil {
+			return "", fmt.Errorf("record type %s already exists", recordType)
+		}
+		desc := &Record{Fields: []*Field{NewField("%rec", recordType)}}
+		for _, change := range changes {
+			if err := change.apply(desc); err != nil {
+				return "", err
+			}
+		}
+		db.RecordSets = append(db.RecordSets, &RecordSet{Descriptor: desc})
+		return fmt.Sprintf("Record type %s created", recordType), nil
+	})
+}
+
+// AlterType Apply the changes to the descriptor of an existing record type
+func (ro *RecordOperation) AlterType(ctx context.Context, databaseFile, recordType string, changes []DescriptorChange) (*Result, error) {
+	if result, err := ro.checkWritable("AlterType"); err != nil {
+		return result, err
+	}
+	if len(changes) == 0 {
+		return failedResult(errors.New("at least one change is required"))
+	}
+
+	return ro.editDescriptors(ctx, databaseFile, false, func(db *Database) (string, error) {
+		rs := db.RecordSet(recordType)
+		if rs == nil || rs.Descriptor == nil {
+			return "", fmt.Errorf("record type %s not found", recordType)
+		}
+		for _, change := range changes {
+			if err := change.apply(rs.Descriptor); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("Record type %s altered", recordType), nil
+	})
+}
+
+// DropType Remove the descriptor and records of a record type. A type that
+// still has records is only dropped with force.
+func (ro *RecordOperation) DropType(ctx context.Context, databaseFile, recordType string, force bool) (*Result, error) {
+	if result, err := ro.checkWritable("DropType"); err != nil {
+		return result, err
+	}
+
+	var dropped int
+	result, err := ro.editDescriptors(ctx, databaseFile, false, func(db *Database) (string, error) {
+		for i, rs := range db.RecordSets {
+			if rs.Descriptor == nil || rs.Type() != recordType {
+				continue
+			}
+			if len(rs.Records) > 0 && !force {
+				return "", fmt.Errorf("record type %s has %d records, set force to drop them", recordType, len(rs.Records))
+			}
+			dropped = len(rs.Records)
+			db.RecordSets = append(db.RecordSets[:i], db.RecordSets[i+1:]...)
+			return fmt.Sprintf("Record type %s dropped with %d records", recordType, dropped), nil
+		}
+		return "", fmt.Errorf("record type %s not found", recordType)
+	})
+	if result != nil && result.Success {
+		result.Affected = dropped
+	}
+	return result, err
+}
+
+// editDescriptors Edit the parsed database under an exclusive lock, check the
+// result with recfix and write it, see checkedMutation. edit returns the
+// output message.
+func (ro *RecordOperation) editDescriptors(ctx context.Context, databaseFile string, create bool, edit func(*Database) (string, error)) (*Result, error) {
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	_, statErr := os.Stat(databaseFile)
+	created := create && errors.Is(statErr, os.ErrNotExist)
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, create)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	result, err := ro.editDatabase(ctx, databaseFile, edit)
+	if created && (err != nil || !result.Success) {
+		os.Remove(databaseFile)
+	}
+	return result, err
+}
+
+// editDatabase Apply edit to an already locked database. The edit is made
+// on a working copy and, like the record mutations, only applied when it
+// introduces no new integrity errors.
+func (ro *RecordOperation) editDatabase(ctx context.Context, databaseFile string, edit func(*Database) (string, error)) (*Result, error) {
+	return ro.checkedMutation(ctx, databaseFile, func(path string) (*Result, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return failedResult(fmt.Errorf("failed to read database file: %w", err))
+		}
+		db, err := Parse(bytes.NewReader(content))
+		if err != nil {
+			return failedResult(fmt.Errorf("failed to parse database file: %w", err))
+		}
+
+		output, err := edit(db)
+		if err != nil {
+			return failedResult(err)
+		}
+		if err := writeDatabase(path, db); err != nil {
+			return failedResult(err)
+		}
+		return &Result{Success: true, Output: output, Error: ""}, nil
+	})
+}
@@ -0,0 +1,195 @@
+// recutils package: Unit tests for creating, altering and dropping record types
+package recutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRecfix Operation whose recfix accepts its input unless it contains
+// reject, reporting an error per occurrence and recording every checked input
+func fakeRecfix(reject string, checked *[]string) *RecordOperation {
+	return NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		*checked = append(*checked, stdin)
+		if n := strings.Count(stdin, reject); reject != "" && n > 0 {
+			return RunOutput{Stderr: strings.Repeat("recfix: error: invalid descriptor\n", n), ExitCode: 1}, nil
+		}
+		return RunOutput{}, nil
+	})))
+}
+
+// TestDescriptorChange tests applying changes to a descriptor
+func TestDescriptorChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  DescriptorChange
+		want    string
+		wantErr bool
+	}{
+		{"SetReplaces", DescriptorChange{"set", "%key", "Email"}, "%rec: Person\n%key: Email\n%mandatory: Name Email\n%type: Id,Age int\n%type: Name line\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n", false},
+		{"SetWithoutPercent", DescriptorChange{"set", "doc", "People"}, "%rec: Person\n%key: Id\n%mandatory: Name Email\n%type: Id,Age int\n%type: Name line\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n%doc: People\n", false},
+		{"AddAfterSameName", DescriptorChange{"add", "%type", "Email email"}, "%rec: Person\n%key: Id\n%mandatory: Name Email\n%type: Id,Age int\n%type: Name line\n%type: Email email\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n", false},
+		{"RemoveAll", DescriptorChange{"remove", "%type", ""}, "%rec: Person\n%key: Id\n%mandatory: Name Email\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n", false},
+		{"RemoveListEntry", DescriptorChange{"remove", "%mandatory", "Email"}, "%rec: Person\n%key: Id\n%mandatory: Name\n%type: Id,Age int\n%type: Name line\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n", false},
+		{"RemoveTypedField", DescriptorChange{"remove", "%type", "Age"}, "%rec: Person\n%key: Id\n%mandatory: Name Email\n%type: Id int\n%type: Name line\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n", false},
+		{"RemoveTypedef", DescriptorChange{"remove", "%typedef", "Age_t"}, "%rec: Person\n%key: Id\n%mandatory: Name Email\n%type: Id,Age int\n%type: Name line\n%typedef: Id_t int\n", false},
+		{"RemoveExactValue", DescriptorChange{"remove", "%key", "Id"}, "%rec: Person\n%mandatory: Name Email\n%type: Id,Age int\n%type: Name line\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n", false},
+		{"RecIsNotChangeable", DescriptorChange{"set", "%rec", "Other"}, "", true},
+		{"UnknownField", DescriptorChange{"add", "Name", "x"}, "", true},
+		{"UnknownAction", DescriptorChange{"rename", "%key", "Id"}, "", true},
+		{"MissingValue", DescriptorChange{"add", "%key", " "}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Parse(strings.NewReader("%rec: Person\n%key: Id\n%mandatory: Name Email\n%type: Id,Age int\n%type: Name line\n%typedef: Id_t int\n%typedef: Age_t range 0 120\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			desc := db.RecordSet("Person").Descriptor
+			err = tt.change.apply(desc)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+			if got := desc.String(); got != tt.want {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestCreateAlterDropType tests managing record types of a database file
+func TestCreateAlterDropType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	var checked []string
+	op := fakeRecfix("%key: Bad", &checked)
+	ctx := context.Background()
+
+	result, err := op.CreateType(ctx, path, "Person", []DescriptorChange{
+		{Action: DescriptorSet, Field: "%key", Value: "Id"},
+		{Action: DescriptorAdd, Field: "%type", Value: "Id int"},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("CreateType failed: %+v, %v", result, err)
+	}
+	if len(checked) != 1 {
+		t.Errorf("Expected one recfix check, got %d", len(checked))
+	}
+	if result, _ := op.CreateType(ctx, path, "Person", nil); result.Success {
+		t.Error("Expected creating an existing type to fail")
+	}
+	if result, _ := op.CreateType(ctx, path, "Bad Name", nil); result.Success {
+		t.Error("Expected an invalid type name to fail")
+	}
+
+	// Add a record so dropping needs force
+	content, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, append(content, "\nId: 1\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = op.AlterType(ctx, path, "Person", []DescriptorChange{
+		{Action: DescriptorAdd, Field: "mandatory", Value: "Id"},
+		{Action: DescriptorSet, Field: "%doc", Value: "People"},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("AlterType failed: %+v, %v", result, err)
+	}
+	content, _ = os.ReadFile(path)
+	if want := "%rec: Person\n%key: Id\n%type: Id int\n%mandatory: Id\n%doc: People\n\nId: 1\n"; string(content) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, content)
+	}
+
+	// A change recfix rejects leaves the file alone
+	result, err = op.AlterType(ctx, path, "Person", []DescriptorChange{{Action: DescriptorSet, Field: "%key", Value: "Bad"}})
+	if err != nil || result.Success || len(result.Diagnostics) != 1 || result.Diagnostics[0].Message != "invalid descriptor" {
+		t.Errorf("Expected recfix to reject the change with a diagnostic, got %+v, %v", result, err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(content) {
+		t.Errorf("Rejected change was written:\n%s", after)
+	}
+	if result, _ := op.AlterType(ctx, path, "Task", []DescriptorChange{{Action: DescriptorSet, Field: "%key", Value: "Id"}}); result.Success {
+		t.Error("Expected altering a missing type to fail")
+	}
+
+	if result, _ := op.DropType(ctx, path, "Person", false); result.Success {
+		t.Error("Expected dropping a type with records to need force")
+	}
+	result, err = op.DropType(ctx, path, "Person", true)
+	if err != nil || !result.Success || result.Affected != 1 {
+		t.Fatalf("DropType failed: %+v, %v", result, err)
+	}
+	if after, _ := os.ReadFile(path); strings.TrimSpace(string(after)) != "" {
+		t.Errorf("Expected an empty database, got:\n%s", after)
+	}
+}
+
+// TestCreateTypeRejectedNewFile tests that a rejected type does not leave a
+// new database behind
+func TestCreateTypeRejectedNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.rec")
+	var checked []string
+	op := fakeRecfix("%rec", &checked)
+
+	result, err := op.CreateType(context.Background(), path, "Person", nil)
+	if err != nil || result.Success {
+		t.Fatalf("Expected recfix to reject the type, got %+v, %v", result, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", path, err)
+	}
+}
+
+// TestTypeChangesKeepExistingErrors tests that integrity errors already in
+// the database do not block a type change
+func TestTypeChangesKeepExistingErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	existing := "%rec: Person\n%key: Broken\n\nName: John Doe\n"
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var checked []string
+	op := fakeRecfix("%key: Broken", &checked)
+	ctx := context.Background()
+
+	result, err := op.AlterType(ctx, path, "Person", []DescriptorChange{{Action: DescriptorSet, Field: "%doc", Value: "People"}})
+	if err != nil || !result.Success {
+		t.Fatalf("Expected the change to be applied despite existing errors, got %+v, %v", result, err)
+	}
+	if len(checked) != 2 {
+		t.Errorf("Expected the change and the original to be checked, got %d checks", len(checked))
+	}
+	content, _ := os.ReadFile(path)
+	if want := "%rec: Person\n%key: Broken\n%doc: People\n\nName: John Doe\n"; string(content) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, content)
+	}
+
+	result, err = op.CreateType(ctx, path, "Task", []DescriptorChange{{Action: DescriptorSet, Field: "%key", Value: "Broken"}})
+	if err != nil || result.Success || len(result.Diagnostics) != 1 {
+		t.Errorf("Expected a new error to block the change, got %+v, %v", result, err)
+	}
+}
+
+// TestTypeChangesReadOnly tests that read-only operations refuse type changes
+func TestTypeChangesReadOnly(t *testing.T) {
+	op := NewRecordOperation(WithReadOnly())
+	ctx := context.Background()
+	if result, err := op.CreateType(ctx, "db.rec", "Person", nil); err == nil || result.Success {
+		t.Errorf("Expected CreateType to be refused, got %+v", result)
+	}
+	if result, err := op.AlterType(ctx, "db.rec", "Person", nil); err == nil || result.Success {
+		t.Errorf("Expected AlterType to be refused, got %+v", result)
+	}
+	if result, err := op.DropType(ctx, "db.rec", "Person", true); err == nil || result.Success {
+		t.Errorf("Expected DropType to be refused, got %+v", result)
+	}
+}
@@ -0,0 +1,117 @@
+// recutils package: Self-check of the recutils installation and roots
+package recutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// RequiredBinaries recutils binaries the operations cannot work without
+var RequiredBinaries = []string{"recsel", "recins", "recdel", "recset", "recinf", "recfix"}
+
+// OptionalBinaries recutils binaries that are checked but not required
+var OptionalBinaries = []string{"recfmt", "csv2rec", "rec2csv"}
+
+// versionTimeout Time a binary may take to print its version
+const versionTimeout = 5 * time.Second
+
+// BinaryStatus Availability of a recutils binary
+type BinaryStatus struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Path     string `json:"path,omitempty"`
+	Version  string `json:"version,omitempty"` // first line of --version
+	Error    string `json:"error,omitempty"`
+}
+
+// RootStatus Usability of a configured root directory
+type RootStatus struct {
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+// pathLooker Runner that can locate binaries before running them
+type pathLooker interface {
+	LookPath(name string) (string, error)
+}
+
+// CheckBinaries Locate the recutils binaries and report their versions
+func (ro *RecordOperation) CheckBinaries(ctx context.Context) []BinaryStatus {
+	var statuses []BinaryStatus
+	for _, name := range RequiredBinaries {
+		statuses = append(statuses, ro.checkBinary(ctx, name, true))
+	}
+	for _, name := range OptionalBinaries {
+		statuses = append(statuses, ro.checkBinary(ctx, name, false))
+	}
+	return statuses
+}
+
+// checkBinary Locate one binary and run it with --version
+func (ro *RecordOperation) checkBinary(ctx context.Context, name string, required bool) BinaryStatus {
+	status := BinaryStatus{Name: name, Required: required}
+	if looker, ok := ro.runner.(pathLooker); ok {
+		path, err := looker.LookPath(name)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		status.Path = path
+	}
+
+	ctx = ContextWithCommandTimeout(ctx, versionTimeout)
+	result, err := ro.executeRecCommand(ctx, []string{name, "--version"}, "")
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case !result.Success:
+		status.Error, _, _ = strings.Cut(strings.TrimSpace(result.Error), "\n")
+		if status.Error == "" {
+			status.Error = "--version failed"
+		}
+	default:
+		status.Version, _, _ = strings.Cut(result.Output, "\n")
+	}
+	return status
+}
+
+// CheckRoots Check that every configured root is an accessible directory,
+// and writable unless the operation is read-only
+func (ro *RecordOperation) CheckRoots() []RootStatus {
+	statuses := make([]RootStatus, 0, len(ro.roots))
+	for _, root := range ro.roots {
+		status := RootStatus{Path: root}
+		if err := ro.checkRoot(root); err != nil {
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// checkRoot Check a single root directory
+func (ro *RecordOperation) checkRoot(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	if _, err := os.ReadDir(root); err != nil {
+		return err
+	}
+	if ro.readOnly {
+		return nil
+	}
+
+	f, err := os.CreateTemp(root, ".recutils-mcp-check-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
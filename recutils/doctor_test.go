@@ -0,0 +1,94 @@
+// recutils package: Unit tests for the installation self-check
+package recutils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckBinaries tests locating recutils binaries and their versions
+func TestCheckBinaries(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available, skipping test")
+	}
+
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"recsel": "#!/bin/sh\necho 'recsel (GNU recutils) 1.9'\necho 'Copyright'\n",
+		"recins": "#!/bin/sh\necho 'recins: error: broken' >&2\nexit 1\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses := NewRecordOperation(WithBinDir(dir)).CheckBinaries(context.Background())
+	if len(statuses) != len(RequiredBinaries)+len(OptionalBinaries) {
+		t.Fatalf("Expected a status per binary, got %+v", statuses)
+	}
+
+	byName := map[string]BinaryStatus{}
+	for _, status := range statuses {
+		byName[status.Name] = status
+	}
+
+	recsel := byName["recsel"]
+	if recsel.Error != "" || recsel.Version != "recsel (GNU recutils) 1.9" || recsel.Path != filepath.Join(dir, "recsel") || !recsel.Required {
+		t.Errorf("Unexpected recsel status %+v", recsel)
+	}
+	if recins := byName["recins"]; recins.Error != "recins: error: broken" {
+		t.Errorf("Unexpected recins status %+v", recins)
+	}
+	if recdel := byName["recdel"]; recdel.Error == "" || recdel.Path != "" {
+		t.Errorf("Expected missing recdel, got %+v", recdel)
+	}
+	if recfix := byName["recfix"]; !recfix.Required || recfix.Error == "" {
+		t.Errorf("Expected missing required recfix, got %+v", recfix)
+	}
+	if recfmt := byName["recfmt"]; recfmt.Required || recfmt.Error == "" {
+		t.Errorf("Expected missing optional recfmt, got %+v", recfmt)
+	}
+}
+
+// TestCheckBinariesRunner tests the self-check with runners that cannot locate binaries
+func TestCheckBinariesRunner(t *testing.T) {
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		return RunOutput{Stdout: argv[0] + " 1.9\n"}, nil
+	})))
+
+	for _, status := range op.CheckBinaries(context.Background()) {
+		if status.Error != "" || status.Version != status.Name+" 1.9" || status.Path != "" {
+			t.Errorf("Unexpected status %+v", status)
+		}
+	}
+}
+
+// TestCheckRoots tests root directory checks
+func TestCheckRoots(t *testing.T) {
+	good := t.TempDir()
+	file := filepath.Join(t.TempDir(), "db.rec")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	statuses := NewRecordOperation(WithRoots(good, file, missing)).CheckRoots()
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 statuses, got %+v", statuses)
+	}
+	if statuses[0].Error != "" {
+		t.Errorf("Expected usable root, got %+v", statuses[0])
+	}
+	if statuses[1].Error == "" || statuses[2].Error == "" {
+		t.Errorf("Expected errors for file and missing roots, got %+v", statuses[1:])
+	}
+
+	entries, _ := os.ReadDir(good)
+	if len(entries) != 0 {
+		t.Errorf("Write check left files behind: %v", entries)
+	}
+}
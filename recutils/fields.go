@@ -0,0 +1,156 @@
+// recutils package: Ordered and repeated fields of inserted records
+package recutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldValue Field of a record to insert. Several FieldValues with the same
+// name make a repeated field, e.g. two Email fields.
+type FieldValue struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// text Value as written to the database
+func (f FieldValue) text() string {
+	return formatValue(f.Value)
+}
+
+// formatValue Format a field value decoded from JSON as written to the
+// database. Numbers, which JSON decodes to float64, are written in plain
+// decimal notation, so 2000000 does not become 2e+06.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// listValue Elements of an array value, which stands for one field per
+// element
+func listValue(value interface{}) ([]interface{}, bool) {
+	switch list := value.(type) {
+	case []interface{}:
+		return list, true
+	case []string:
+		elements := make([]interface{}, len(list))
+		for i, v := range list {
+			elements[i] = v
+		}
+		return elements, true
+	}
+	return nil, false
+}
+
+// appendField Append name with value, or with each element of an array value
+func appendField(values []FieldValue, name string, value interface{}) []FieldValue {
+	if list, ok := listValue(value); ok {
+		for _, v := range list {
+			values = append(values, FieldValue{Name: name, Value: v})
+		}
+		return values
+	}
+	return append(values, FieldValue{Name: name, Value: value})
+}
+
+// fieldValues Flatten a field map in name order. Array values become one
+// field per element.
+func fieldValues(fields map[string]interface{}) []FieldValue {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]FieldValue, 0, len(fields))
+	for _, name := range names {
+		values = appendField(values, name, fields[name])
+	}
+	return values
+}
+
+// ParseFieldValues Read an ordered field list decoded from JSON, a list of
+// {"name": ..., "value": ...} objects. Array values become one field per
+// element.
+func ParseFieldValues(list []interface{}) ([]FieldValue, error) {
+	values := make([]FieldValue, 0, len(list))
+	for i, item := range list {
+		pair, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %d: expected an object with name and value", i+1)
+		}
+		name, ok := pair["name"].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("field %d: name must be a non-empty string", i+1)
+		}
+		value, ok := pair["value"]
+		if !ok {
+			return nil, fmt.Errorf("field %d (%s): value is missing", i+1, name)
+		}
+		values = appendField(values, name, value)
+	}
+	return values, nil
+}
+
+// declaredOrder Position of each field name in the descriptor, in order of
+// first mention by %key, %mandatory, %allowed, %type and the other special
+// fields listing field names
+func (rs *RecordSet) declaredOrder() map[string]int {
+	order := map[string]int{}
+	if rs == nil || rs.Descriptor == nil {
+		return order
+	}
+	declare := func(names ...string) {
+		for _, name := range names {
+			if _, ok := order[name]; !ok && name != "" {
+				order[name] = len(order)
+			}
+		}
+	}
+	for _, f := range rs.Descriptor.Fields {
+		value := strings.TrimSpace(f.Value)
+		switch {
+		case f.Name == "%key":
+			declare(firstWord(value))
+		case f.Name == "%type":
+			fieldList, _, _ := cutWord(value)
+			for _, name := range strings.Split(fieldList, ",") {
+				declare(strings.TrimSpace(name))
+			}
+		case listFields[f.Name]:
+			declare(strings.Fields(value)...)
+		}
+	}
+	return order
+}
+
+// sortDeclared Order values by the declared order of rs. Undeclared fields
+// follow the declared ones; repeated fields keep their order.
+func sortDeclared(values []FieldValue, rs *RecordSet) {
+	order := rs.declaredOrder()
+	position := func(name string) int {
+		if i, ok := order[name]; ok {
+			return i
+		}
+		return len(order)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return position(values[i].Name) < position(values[j].Name)
+	})
+}
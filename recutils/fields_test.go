@@ -0,0 +1,203 @@
+// recutils package: Unit tests for ordered and repeated insert fields
+package recutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFieldValues tests flattening field maps
+func TestFieldValues(t *testing.T) {
+	got := fieldValues(map[string]interface{}{
+		"Name":  "John Doe",
+		"Email": []interface{}{"john@example.com", "jd@example.com"},
+		"Age":   30,
+		"Tags":  []string{"a"},
+	})
+	want := []FieldValue{
+		{Name: "Age", Value: 30},
+		{Name: "Email", Value: "john@example.com"},
+		{Name: "Email", Value: "jd@example.com"},
+		{Name: "Name", Value: "John Doe"},
+		{Name: "Tags", Value: "a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+// TestParseFieldValues tests reading ordered field lists
+func TestParseFieldValues(t *testing.T) {
+	got, err := ParseFieldValues([]interface{}{
+		map[string]interface{}{"name": "Name", "value": "John Doe"},
+		map[string]interface{}{"name": "Email", "value": "john@example.com"},
+		map[string]interface{}{"name": "Email", "value": []interface{}{"jd@example.com"}},
+	})
+	want := []FieldValue{
+		{Name: "Name", Value: "John Doe"},
+		{Name: "Email", Value: "john@example.com"},
+		{Name: "Email", Value: "jd@example.com"},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v, %v", want, got, err)
+	}
+
+	for _, invalid := range [][]interface{}{
+		{"Name: John"},
+		{map[string]interface{}{"value": "John"}},
+		{map[string]interface{}{"name": "", "value": "John"}},
+		{map[string]interface{}{"name": "Name"}},
+	} {
+		if _, err := ParseFieldValues(invalid); err == nil {
+			t.Errorf("Expected %v to be rejected", invalid)
+		}
+	}
+}
+
+// TestSortDeclared tests ordering fields by the record descriptor
+func TestSortDeclared(t *testing.T) {
+	db, err := Parse(strings.NewReader("%rec: Person\n%key: Id\n%mandatory: Name\n%type: Email,Phone email\n%allowed: Id Name Email Phone Age\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := fieldValues(map[string]interface{}{
+		"Age":   30,
+		"Email": []interface{}{"a@example.com", "b@example.com"},
+		"Id":    1,
+		"Name":  "John",
+		"Notes": "x",
+		"City":  "Paris",
+	})
+	sortDeclared(values, db.RecordSet("Person"))
+
+	var names []string
+	for _, v := range values {
+		names = append(names, v.Name+"="+v.text())
+	}
+	want := []string{"Id=1", "Name=John", "Email=a@example.com", "Email=b@example.com", "Age=30", "City=Paris", "Notes=x"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+}
+
+// TestInsertFieldOrder tests the record text passed to recins and written to
+// new databases
+func TestInsertFieldOrder(t *testing.T) {
+	var record string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		if argv[0] == "recins" {
+			record = argv[4]
+		}
+		return RunOutput{}, nil
+	})))
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	existing := filepath.Join(dir, "people.rec")
+	if err := os.WriteFile(existing, []byte("%rec: Person\n%key: Id\n%mandatory: Name\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.InsertRecord(ctx, existing, "Person", map[string]interface{}{
+		"Email": []interface{}{"a@example.com", "b@example.com"},
+		"Name":  "John",
+		"Id":    1,
+	}); err != nil {
+		t.Fatalf("InsertRecord failed: %v", err)
+	}
+	if want := "Id: 1\nName: John\nEmail: a@example.com\nEmail: b@example.com"; record != want {
+		t.Errorf("Expected recins record:\n%s\ngot:\n%s", want, record)
+	}
+
+	if _, err := op.InsertRecordFields(ctx, existing, "Person", []FieldValue{
+		{Name: "Name", Value: "Jane"},
+		{Name: "Email", Value: "j@example.com"},
+		{Name: "Id", Value: 2},
+		{Name: "Email", Value: "jane@example.com"},
+	}); err != nil {
+		t.Fatalf("InsertRecordFields failed: %v", err)
+	}
+	if want := "Name: Jane\nEmail: j@example.com\nId: 2\nEmail: jane@example.com"; record != want {
+		t.Errorf("Expected recins record:\n%s\ngot:\n%s", want, record)
+	}
+
+	if _, err := op.InsertRecord(ctx, existing, "Person", map[string]interface{}{"Id": float64(2000000), "Name": "Big"}); err != nil {
+		t.Fatalf("InsertRecord failed: %v", err)
+	}
+	if want := "Id: 2000000\nName: Big"; record != want {
+		t.Errorf("Expected recins record:\n%s\ngot:\n%s", want, record)
+	}
+
+	created := filepath.Join(dir, "new.rec")
+	if _, err := op.InsertRecord(ctx, created, "Person", map[string]interface{}{"Name": "John", "Email": []string{"a@example.com", "b@example.com"}}); err != nil {
+		t.Fatalf("InsertRecord failed: %v", err)
+	}
+	content, _ := os.ReadFile(created)
+	if want := "%rec: Person\n\nEmail: a@example.com\nEmail: b@example.com\nName: John\n"; string(content) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, content)
+	}
+}
+
+// TestRecordSetAll tests replacing repeated fields
+func TestRecordSetAll(t *testing.T) {
+	tests := []struct {
+		record string
+		values []string
+		want   string
+	}{
+		{"Name: a\nEmail: x\nAge: 1\n", []string{"y", "z"}, "Name: a\nEmail: y\nEmail: z\nAge: 1\n"},
+		{"Email: x\nName: a\nEmail: w\nEmail: v\n", []string{"y"}, "Email: y\nName: a\n"},
+		{"Name: a\n", []string{"y", "z"}, "Name: a\nEmail: y\nEmail: z\n"},
+		{"Name: a\nEmail: x\n", nil, "Name: a\n"},
+	}
+	for _, tt := range tests {
+		db, err := Parse(strings.NewReader(tt.record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.RecordSets[0].Records[0].SetAll("Email", tt.values)
+		if got := db.String(); got != tt.want {
+			t.Errorf("SetAll(%q) on %q: expected %q, got %q", tt.values, tt.record, tt.want, got)
+		}
+	}
+}
+
+// TestUpdateRepeatedFields tests updating a field with an array value,
+// directly and within a transaction
+func TestUpdateRepeatedFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	const content = "%rec: Person\n\nName: John\nEmail: old@example.com\n"
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		if argv[0] == "recsel" {
+			return RunOutput{Stdout: "Name: John\nEmail: old@example.com\n"}, nil
+		}
+		return RunOutput{}, nil
+	})))
+	ctx := context.Background()
+	want := "%rec: Person\n\nName: John\nEmail: x@example.com\nEmail: z@example.com\n"
+	emails := map[string]interface{}{"Email": []interface{}{"x@example.com", "z@example.com"}}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := op.UpdateRecords(ctx, path, "Person", "Name = 'John'", emails); err != nil || !result.Success {
+		t.Fatalf("UpdateRecords failed: %+v, %v", result, err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := op.RunTransaction(ctx, path, []TxStep{{Operation: "update", RecordType: "Person", QueryExpression: "Name = 'John'", Fields: emails}})
+	if err != nil || !result.Success {
+		t.Fatalf("RunTransaction failed: %+v, %v", result, err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,282 @@
+// recutils package: Integrity checking and repair with recfix
+package recutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FixOperation recfix operation
+type FixOperation string
+
+const (
+	FixCheck   FixOperation = "check"   // report integrity errors
+	FixSort    FixOperation = "sort"    // sort records by %sort
+	FixAuto    FixOperation = "auto"    // fill in missing %auto fields
+	FixEncrypt FixOperation = "encrypt" // encrypt %confidential fields
+	FixDecrypt FixOperation = "decrypt" // decrypt %confidential fields
+)
+
+// FixOptions recfix parameters
+type FixOptions struct {
+	Operation FixOperation // check when empty
+	// Password encrypts or decrypts confidential fields. It is required by
+	// encrypt and decrypt, which would otherwise prompt for it.
+	Password   string
+	Force      bool // with encrypt, also encrypt fields that look encrypted
+	NoExternal bool // do not follow external descriptors
+}
+
+// Diagnostic Integrity error reported by recfix
+type Diagnostic struct {
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`        // 1-based line of the record, 0 when unknown
+	RecordType string `json:"record_type,omitempty"` // type of the record at Line
+	Field      string `json:"field,omitempty"`       // field named by the message
+	Message    string `json:"message"`
+}
+
+// diagnosticLine "FILE: LINE: error: MESSAGE" as printed by recfix
+var diagnosticLine = regexp.MustCompile(`^(.*?):\s*(\d+):\s*(?:error|warning):\s*(.*)$`)
+
+// quotedField Field name quoted in a recfix message, e.g. 'Name'
+var quotedField = regexp.MustCompile(`'([%A-Za-z][A-Za-z0-9_]*)'`)
+
+// parseDiagnostics Parse the messages recfix printed about content, which was
+// read from databaseFile. Lines are matched to the record sets of content;
+// output that is not a recfix message is skipped.
+func parseDiagnostics(stderr, databaseFile, content string) []Diagnostic {
+	db, _ := Parse(strings.NewReader(content))
+
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		d := Diagnostic{File: databaseFile}
+		if m := diagnosticLine.FindStringSubmatch(line); m != nil {
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Message = m[3]
+		} else if rest, ok := strings.CutPrefix(line, "recfix: "); ok {
+			d.Message = strings.TrimPrefix(rest, "error: ")
+		} else {
+			continue
+		}
+		if m := quotedField.FindStringSubmatch(d.Message); m != nil {
+			d.Field = m[1]
+		}
+		if db != nil && d.Line > 0 {
+			d.RecordType = db.recordTypeAt(d.Line)
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// recordTypeAt Type of the record set containing line
+func (db *Database) recordTypeAt(line int) string {
+	recordType := ""
+	for _, rs := range db.RecordSets {
+		start := 0
+		if rs.Descriptor != nil {
+			start = rs.Descriptor.Line
+		} else if len(rs.Records) > 0 {
+			start = rs.Records[0].Line
+		}
+		if start > line {
+			break
+		}
+		recordType = rs.Type()
+	}
+	return recordType
+}
+
+// Check Report the integrity errors of a database with recfix --check. The
+// result succeeds only if there are none.
+func (ro *RecordOperation) Check(ctx context.Context, databaseFile string) (*Result, error) {
+	return ro.Fix(ctx, databaseFile, FixOptions{Operation: FixCheck})
+}
+
+// Fix Run recfix on a database. Every operation other than check changes the
+// database in place.
+func (ro *RecordOperation) Fix(ctx context.Context, databaseFile string, opts FixOptions) (*Result, error) {
+	operation := opts.Operation
+	if operation == "" {
+		operation = FixCheck
+	}
+	mode := lockExclusive
+	switch operation {
+	case FixCheck:
+		mode = lockShared
+	case FixSort, FixAuto:
+	case FixEncrypt, FixDecrypt:
+		if opts.Password == "" {
+			return failedResult(fmt.Errorf("%s requires a password", operation))
+		}
+	default:
+		return failedResult(fmt.Errorf("unknown operation %q, expected check, sort, auto, encrypt or decrypt", operation))
+	}
+	if mode == lockExclusive {
+		if result, err := ro.checkWritable("Fix"); err != nil {
+			return result, err
+		}
+	}
+
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+	unlock, err := ro.lockDatabase(ctx, databaseFile, mode, false)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	content, err := os.ReadFile(databaseFile)
+	if err != nil {
+		return failedResult(fmt.Errorf("failed to read database file: %w", err))
+	}
+
+	cmd := []string{"recfix", "--" + string(operation)}
+	if opts.Password != "" {
+		cmd = append(cmd, "-s", opts.Password)
+	}
+	if opts.Force {
+		cmd = append(cmd, "--force")
+	}
+	if opts.NoExternal {
+		cmd = append(cmd, "--no-external")
+	}
+	cmd = append(cmd, databaseFile)
+
+	result, err := ro.executeRecCommand(ctx, cmd, "")
+	if err != nil || result.Success {
+		if result.Success {
+			result.Output = fmt.Sprintf("recfix --%s completed without errors", operation)
+		}
+		return result, err
+	}
+	if diagnostics := parseDiagnostics(result.Error, databaseFile, string(content)); len(diagnostics) > 0 {
+		result.Diagnostics = diagnostics
+		result.Error = fmt.Sprintf("%d integrity errors", len(diagnostics))
+	}
+	return result, nil
+}
+
+// checkContent Run recfix --check on content. It returns the integrity
+// errors, or an error if recfix could not check it.
+func (ro *RecordOperation) checkContent(ctx context.Context, databaseFile, content string) ([]Diagnostic, error) {
+	result, err := ro.executeRecCommand(ctx, []string{"recfix", "--check"}, content)
+	if err != nil {
+		return nil, err
+	}
+	if result.Success {
+		return nil, nil
+	}
+	if result.TimedOut {
+		return nil, errors.New(result.Error)
+	}
+	diagnostics := parseDiagnostics(result.Error, databaseFile, content)
+	if len(diagnostics) == 0 {
+		return nil, fmt.Errorf("recfix failed: %s", strings.TrimSpace(result.Error))
+	}
+	return diagnostics, nil
+}
+
+// IntegrityError Change rejected because it introduced integrity errors
+type IntegrityError struct {
+	Diagnostics []Diagnostic
+}
+
+// Error Implement the error interface
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("change introduced %d integrity errors", len(e.Diagnostics))
+}
+
+// checkedMutation Apply mutate to a working copy of an already locked
+// database and check the copy with recfix before it replaces the database,
+// so the database never holds unchecked content. A change introducing
+// integrity errors that were not there before is not applied and the new
+// errors are reported. mutate receives the path of the working copy.
+func (ro *RecordOperation) checkedMutation(ctx context.Context, databaseFile string, mutate func(path string) (*Result, error)) (*Result, error) {
+	before, err := os.ReadFile(databaseFile)
+	if err != nil {
+		return failedResult(fmt.Errorf("failed to read database file: %w", err))
+	}
+	workingCopy, err := createWorkingCopy(databaseFile, before, "check")
+	if err != nil {
+		return failedResult(err)
+	}
+	defer os.Remove(workingCopy)
+
+	result, err := mutate(workingCopy)
+	if err != nil || result == nil || !result.Success {
+		return result, err
+	}
+
+	after, err := os.ReadFile(workingCopy)
+	if err != nil {
+		return failedResult(fmt.Errorf("failed to read working copy: %w", err))
+	}
+	if bytes.Equal(before, after) {
+		return result, nil
+	}
+	introduced, err := ro.newDiagnostics(ctx, databaseFile, string(before), string(after))
+	if err != nil {
+		return failedResult(fmt.Errorf("integrity check failed, change not applied: %w", err))
+	}
+	if len(introduced) > 0 {
+		return &Result{
+			Success:     false,
+			Output:      "",
+			Error:       "change not applied: " + (&IntegrityError{Diagnostics: introduced}).Error(),
+			Diagnostics: introduced,
+		}, nil
+	}
+
+	if err := writeFileAtomic(databaseFile, after, 0644); err != nil {
+		return failedResult(fmt.Errorf("failed to write database file: %w", err))
+	}
+	return result, nil
+}
+
+// newDiagnostics Integrity errors of after that before does not have.
+// Errors are told apart by record type, field and message, as lines move.
+func (ro *RecordOperation) newDiagnostics(ctx context.Context, databaseFile, before, after string) ([]Diagnostic, error) {
+	found, err := ro.checkContent(ctx, databaseFile, after)
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+
+	existing := map[Diagnostic]int{}
+	if strings.TrimSpace(before) != "" {
+		previous, err := ro.checkContent(ctx, databaseFile, before)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range previous {
+			d.Line = 0
+			existing[d]++
+		}
+	}
+
+	var introduced []Diagnostic
+	for _, d := range found {
+		key := d
+		key.Line = 0
+		if existing[key] > 0 {
+			existing[key]--
+			continue
+		}
+		introduced = append(introduced, d)
+	}
+	return introduced, nil
+}
@@ -0,0 +1,211 @@
+// recutils package: Unit tests for recfix integrity checks
+package recutils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testFixDatabase Database with two record sets
+const testFixDatabase = `%rec: Person
+%key: Id
+%mandatory: Name
+
+Id: 1
+Name: John Doe
+
+%rec: Project
+
+Title: Garden
+`
+
+// fakeIntegrity Runner answering recfix --check with an error for every
+// record missing a Name, and recsel with the records of Person matching
+// "Id = 1"
+func fakeIntegrity(t *testing.T) RunnerFunc {
+	return func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		switch argv[0] {
+		case "recfix":
+			var stderr strings.Builder
+			lineNo := 0
+			for _, record := range strings.Split(stdin, "\n\n") {
+				if strings.HasPrefix(record, "Id:") && !strings.Contains(record, "Name:") {
+					stderr.WriteString("stdin: " + strconv.Itoa(lineNo+1) + ": error: mandatory field 'Name' not found in record\n")
+				}
+				lineNo += strings.Count(record, "\n") + 2
+			}
+			if stderr.Len() > 0 {
+				return RunOutput{Stderr: stderr.String(), ExitCode: 1}, nil
+			}
+			return RunOutput{}, nil
+		case "recsel":
+			return RunOutput{Stdout: "Id: 1\nName: John Doe\n"}, nil
+		}
+		t.Fatalf("Unexpected command %q", argv)
+		return RunOutput{}, nil
+	}
+}
+
+// TestParseDiagnostics tests turning recfix messages into diagnostics
+func TestParseDiagnostics(t *testing.T) {
+	stderr := "people.rec: 5: error: mandatory field 'Name' not found in record\n" +
+		"people.rec: 9: error: duplicated key value in field 'Title' in record\n" +
+		"recfix: error: the file contains encrypted fields\n" +
+		"exec: \"recfix\": executable file not found in $PATH\n"
+
+	got := parseDiagnostics(stderr, "people.rec", testFixDatabase)
+	want := []Diagnostic{
+		{File: "people.rec", Line: 5, RecordType: "Person", Field: "Name", Message: "mandatory field 'Name' not found in record"},
+		{File: "people.rec", Line: 9, RecordType: "Project", Field: "Title", Message: "duplicated key value in field 'Title' in record"},
+		{File: "people.rec", Message: "the file contains encrypted fields"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+// TestFix tests the recfix command lines and results of Fix
+func TestFix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	if err := os.WriteFile(path, []byte(testFixDatabase), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var argv []string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, args []string, stdin string) (RunOutput, error) {
+		argv = args
+		if args[1] == "--check" {
+			return RunOutput{Stderr: path + ": 5: error: mandatory field 'Name' not found in record\n", ExitCode: 1}, nil
+		}
+		return RunOutput{}, nil
+	})))
+	ctx := context.Background()
+
+	result, err := op.Check(ctx, path)
+	if err != nil || result.Success || len(result.Diagnostics) != 1 || result.Diagnostics[0].RecordType != "Person" {
+		t.Errorf("Unexpected check result %+v, %v", result, err)
+	}
+
+	result, err = op.Fix(ctx, path, FixOptions{Operation: FixEncrypt, Password: "secret", Force: true})
+	if err != nil || !result.Success {
+		t.Errorf("Unexpected encrypt result %+v, %v", result, err)
+	}
+	if want := []string{"recfix", "--encrypt", "-s", "secret", "--force", path}; !reflect.DeepEqual(argv, want) {
+		t.Errorf("Expected %q, got %q", want, argv)
+	}
+
+	if result, _ := op.Fix(ctx, path, FixOptions{Operation: FixDecrypt}); result.Success {
+		t.Error("Expected decrypt without a password to fail")
+	}
+	if result, _ := op.Fix(ctx, path, FixOptions{Operation: "compact"}); result.Success {
+		t.Error("Expected an unknown operation to fail")
+	}
+
+	readOnly := NewRecordOperation(WithReadOnly(), WithRunner(RunnerFunc(func(ctx context.Context, args []string, stdin string) (RunOutput, error) {
+		return RunOutput{}, nil
+	})))
+	if result, err := readOnly.Fix(ctx, path, FixOptions{Operation: FixSort}); err == nil || result.Success {
+		t.Errorf("Expected sort to be refused in read-only mode, got %+v", result)
+	}
+	if result, err := readOnly.Check(ctx, path); err != nil || !result.Success {
+		t.Errorf("Expected check to work in read-only mode, got %+v, %v", result, err)
+	}
+}
+
+// TestCheckedMutation tests that mutations are checked before they reach the
+// database, and not applied when they introduce integrity errors
+func TestCheckedMutation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	ctx := context.Background()
+	fake := fakeIntegrity(t)
+	var checked []string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		if argv[0] == "recfix" {
+			// The database must still hold its old content while recfix runs
+			content, _ := os.ReadFile(path)
+			checked = append(checked, string(content))
+		}
+		return fake(ctx, argv, stdin)
+	})))
+
+	write := func(content string) func(string) (*Result, error) {
+		return func(workingCopy string) (*Result, error) {
+			if workingCopy == path {
+				t.Fatal("Expected the mutation to get a working copy")
+			}
+			if err := os.WriteFile(workingCopy, []byte(content), 0644); err != nil {
+				return failedResult(err)
+			}
+			return &Result{Success: true}, nil
+		}
+	}
+
+	t.Run("NewErrorIsNotApplied", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte(testFixDatabase), 0644); err != nil {
+			t.Fatal(err)
+		}
+		checked = nil
+		result, err := op.checkedMutation(ctx, path, write(strings.Replace(testFixDatabase, "Name: John Doe\n", "", 1)))
+		if err != nil || result.Success || len(result.Diagnostics) != 1 || result.Diagnostics[0].Field != "Name" {
+			t.Errorf("Expected a rejected change, got %+v, %v", result, err)
+		}
+		if content, _ := os.ReadFile(path); string(content) != testFixDatabase {
+			t.Errorf("Database changed:\n%s", content)
+		}
+		for _, content := range checked {
+			if content != testFixDatabase {
+				t.Errorf("Database changed before the check:\n%s", content)
+			}
+		}
+		assertNoTempFiles(t, filepath.Dir(path))
+	})
+
+	t.Run("ExistingErrorIsKept", func(t *testing.T) {
+		broken := "%rec: Person\n\nId: 1\n"
+		if err := os.WriteFile(path, []byte(broken), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result, err := op.checkedMutation(ctx, path, write(broken+"\nId: 2\nName: Jane\n"))
+		if err != nil || !result.Success {
+			t.Errorf("Expected the change to be kept, got %+v, %v", result, err)
+		}
+		if content, _ := os.ReadFile(path); string(content) != broken+"\nId: 2\nName: Jane\n" {
+			t.Errorf("Change not written:\n%s", content)
+		}
+	})
+
+	t.Run("RecfixMissing", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte(testFixDatabase), 0644); err != nil {
+			t.Fatal(err)
+		}
+		missing := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+			return RunOutput{}, &exec.Error{Name: argv[0], Err: exec.ErrNotFound}
+		})))
+		result, err := missing.checkedMutation(ctx, path, write(testFixDatabase+"\nTitle: Pond\n"))
+		if err == nil || result.Success || !strings.Contains(result.Error, "integrity check failed") {
+			t.Errorf("Expected the change to fail without recfix, got %+v, %v", result, err)
+		}
+		if content, _ := os.ReadFile(path); string(content) != testFixDatabase {
+			t.Errorf("Database changed:\n%s", content)
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte(testFixDatabase), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result, err := op.UpdateRecords(ctx, path, "Person", "Id = 1", map[string]interface{}{"Email": "john@example.com"})
+		if err != nil || !result.Success || result.Affected != 1 {
+			t.Errorf("UpdateRecords failed: %+v, %v", result, err)
+		}
+		result, err = op.DeleteRecords(ctx, path, "Person", "Id = 1")
+		if err != nil || !result.Success {
+			t.Errorf("DeleteRecords failed: %+v, %v", result, err)
+		}
+	})
+}
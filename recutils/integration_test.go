@@ -136,7 +136,7 @@ func TestRecutilsIntegration(t *testing.T) {
 		// Step 3: Update records (UPDATE)
 		t.Run("Step3_UpdateRecords", func(t *testing.T) {
 			// Update Alice's age
-			result, err := op.UpdateRecords(ctx, dbPath, "Name = 'Alice Johnson'", map[string]interface{}{
+			result, err := op.UpdateRecords(ctx, dbPath, "Person", "Name = 'Alice Johnson'", map[string]interface{}{
 				"Age": 29,
 			})
 			if err != nil || !result.Success {
@@ -159,7 +159,7 @@ func TestRecutilsIntegration(t *testing.T) {
 			}
 
 			// Update Bob's city and add a new field
-			result, err = op.UpdateRecords(ctx, dbPath, "Name = 'Bob Smith'", map[string]interface{}{
+			result, err = op.UpdateRecords(ctx, dbPath, "Person", "Name = 'Bob Smith'", map[string]interface{}{
 				"City":   "Boston",
 				"Status": "Active",
 			})
@@ -183,7 +183,7 @@ func TestRecutilsIntegration(t *testing.T) {
 		// Step 4: Delete records (DELETE)
 		t.Run("Step4_DeleteRecords", func(t *testing.T) {
 			// Delete Charlie's record
-			result, err := op.DeleteRecords(ctx, dbPath, "Name = 'Charlie Brown'")
+			result, err := op.DeleteRecords(ctx, dbPath, "Person", "Name = 'Charlie Brown'")
 			if err != nil || !result.Success {
 				t.Fatalf("Failed to delete Charlie's record: %v, result: %+v", err, result)
 			}
@@ -303,7 +303,7 @@ func TestRecutilsIntegration(t *testing.T) {
 
 	t.Run("UpdateMultipleFieldsAndVerify", func(t *testing.T) {
 		// Update all Seattle residents' city
-		result, err := op.UpdateRecords(ctx, dbPath, "City = 'Seattle'", map[string]interface{}{
+		result, err := op.UpdateRecords(ctx, dbPath, "Person", "City = 'Seattle'", map[string]interface{}{
 			"City": "Bellevue",
 		})
 		if err != nil || !result.Success {
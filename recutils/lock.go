@@ -0,0 +1,85 @@
+// recutils package: Advisory database file locking
+package recutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultLockTimeout Time to wait for a database lock unless configured
+// with WithLockTimeout
+const DefaultLockTimeout = 10 * time.Second
+
+// lockPollInterval Delay between attempts to take a busy lock
+const lockPollInterval = 10 * time.Millisecond
+
+// ErrDatabaseBusy Database stayed locked by another process or operation
+// for the whole lock timeout
+var ErrDatabaseBusy = errors.New("database busy")
+
+// WithLockTimeout Set how long operations wait for a database lock before
+// failing with ErrDatabaseBusy. Zero fails immediately when the lock is held.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(ro *RecordOperation) {
+		ro.lockTimeout = timeout
+	}
+}
+
+// lockMode Kind of database lock
+type lockMode int
+
+const (
+	lockShared    lockMode = iota // queries, any number of holders
+	lockExclusive                 // mutations, a single holder
+)
+
+// lockDatabase Take an advisory flock(2) lock on the database file itself,
+// the same lock `flock db.rec recins ...` and other flock users take. Mutations
+// replace the file by renaming a new one over it, so after locking the path is
+// checked to still name the locked file, retrying otherwise. A missing file is
+// not locked unless create is set, in which case it is created empty. The
+// returned function releases the lock.
+func (ro *RecordOperation) lockDatabase(ctx context.Context, databaseFile string, mode lockMode, create bool) (func(), error) {
+	deadline := time.Now().Add(ro.lockTimeout)
+	for {
+		f, err := os.Open(databaseFile)
+		if errors.Is(err, os.ErrNotExist) && create {
+			f, err = os.OpenFile(databaseFile, os.O_RDONLY|os.O_CREATE, 0644)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return func() {}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database file for locking: %w", err)
+		}
+
+		locked, err := tryLock(f, mode)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock database file: %w", err)
+		}
+		if locked {
+			if current, err := os.Stat(databaseFile); err == nil {
+				if opened, err := f.Stat(); err == nil && os.SameFile(current, opened) {
+					return func() { f.Close() }, nil
+				}
+			}
+			// Replaced or removed while waiting, lock the new file instead
+			f.Close()
+			continue
+		}
+		f.Close()
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s is locked by another operation", ErrDatabaseBusy, databaseFile)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+// recutils package: flock(2) based locking on Unix systems
+package recutils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock Try to lock f without blocking. It reports false when another
+// open file holds a conflicting lock.
+func tryLock(f *os.File, mode lockMode) (bool, error) {
+	how := syscall.LOCK_SH
+	if mode == lockExclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,169 @@
+//go:build unix
+
+// recutils package: Unit tests for database file locking
+package recutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// holdLock Lock path like another process would, until the test ends or
+// the returned function is called
+func holdLock(t *testing.T, path string, how int) func() {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		t.Fatal(err)
+	}
+	release := func() { f.Close() }
+	t.Cleanup(release)
+	return release
+}
+
+// TestLockDatabase tests shared and exclusive database locks
+func TestLockDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.rec")
+	if err := os.WriteFile(path, []byte("Name: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	op := NewRecordOperation(WithLockTimeout(0))
+
+	t.Run("Shared locks coexist", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_SH)
+		defer release()
+
+		unlock, err := op.lockDatabase(ctx, path, lockShared, false)
+		if err != nil {
+			t.Fatalf("Expected shared lock, got %v", err)
+		}
+		unlock()
+	})
+
+	t.Run("Shared lock blocks exclusive", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_SH)
+		defer release()
+
+		if _, err := op.lockDatabase(ctx, path, lockExclusive, false); !errors.Is(err, ErrDatabaseBusy) {
+			t.Errorf("Expected ErrDatabaseBusy, got %v", err)
+		}
+	})
+
+	t.Run("Exclusive lock blocks shared", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_EX)
+		defer release()
+
+		if _, err := op.lockDatabase(ctx, path, lockShared, false); !errors.Is(err, ErrDatabaseBusy) {
+			t.Errorf("Expected ErrDatabaseBusy, got %v", err)
+		}
+	})
+
+	t.Run("Wait for release", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_EX)
+		time.AfterFunc(50*time.Millisecond, release)
+
+		op := NewRecordOperation(WithLockTimeout(5 * time.Second))
+		unlock, err := op.lockDatabase(ctx, path, lockExclusive, false)
+		if err != nil {
+			t.Fatalf("Expected lock after release, got %v", err)
+		}
+		unlock()
+	})
+
+	t.Run("Context canceled while waiting", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_EX)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		op := NewRecordOperation(WithLockTimeout(time.Minute))
+		if _, err := op.lockDatabase(ctx, path, lockExclusive, false); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context error, got %v", err)
+		}
+	})
+
+	t.Run("File replaced while waiting", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_EX)
+		time.AfterFunc(50*time.Millisecond, func() {
+			// Replace the file like an atomic write, then unlock the old one
+			writeFileAtomic(path, []byte("Name: y\n"), 0644)
+			release()
+		})
+
+		op := NewRecordOperation(WithLockTimeout(5 * time.Second))
+		unlock, err := op.lockDatabase(ctx, path, lockExclusive, false)
+		if err != nil {
+			t.Fatalf("Expected lock, got %v", err)
+		}
+		defer unlock()
+
+		// The new file must be the locked one
+		if _, err := NewRecordOperation(WithLockTimeout(0)).lockDatabase(ctx, path, lockShared, false); !errors.Is(err, ErrDatabaseBusy) {
+			t.Errorf("Replacement file is not locked: %v", err)
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing.rec")
+		unlock, err := op.lockDatabase(ctx, missing, lockExclusive, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		unlock()
+		if _, err := os.Stat(missing); !os.IsNotExist(err) {
+			t.Error("Missing file should not be created")
+		}
+
+		unlock, err = op.lockDatabase(ctx, missing, lockExclusive, true)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		unlock()
+		if _, err := os.Stat(missing); err != nil {
+			t.Errorf("Expected file to be created: %v", err)
+		}
+	})
+}
+
+// TestOperationsDatabaseBusy tests that operations fail on locked databases
+func TestOperationsDatabaseBusy(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.rec")
+	testData := "%rec: Person\n\nName: John Doe\nAge: 25\n"
+	if err := os.WriteFile(path, []byte(testData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	op := NewRecordOperation(WithLockTimeout(20 * time.Millisecond))
+
+	t.Run("Mutation on shared lock", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_SH)
+		defer release()
+
+		result, err := op.UpdateRecords(ctx, path, "Person", "Name = 'John Doe'", map[string]interface{}{"Age": 26})
+		if !errors.Is(err, ErrDatabaseBusy) || result == nil || result.Success {
+			t.Errorf("Expected database busy, got %+v, %v", result, err)
+		}
+		if content, _ := os.ReadFile(path); string(content) != testData {
+			t.Errorf("Database was modified: %q", content)
+		}
+	})
+
+	t.Run("Query on exclusive lock", func(t *testing.T) {
+		release := holdLock(t, path, syscall.LOCK_EX)
+		defer release()
+
+		result, err := op.QueryRecords(ctx, path, "", "")
+		if !errors.Is(err, ErrDatabaseBusy) || result == nil || result.Success {
+			t.Errorf("Expected database busy, got %+v, %v", result, err)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+// recutils package: Mutations delegated to recdel and recset
+package recutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selection Record selection shared by recsel, recdel and recset. At most one
+// of Expression, Quick, Indexes and Random may be set.
+type Selection struct {
+	RecordType      string // -t
+	Expression      string // -e
+	Quick           string // -q
+	Indexes         string // -n, e.g. "0,2-4"
+	Random          int    // -m
+	CaseInsensitive bool   // -i
+}
+
+// DeleteOptions recdel options
+type DeleteOptions struct {
+	Selection
+	Comment bool // -c, comment records out instead of deleting them
+	Force   bool // --force, delete even if integrity would be violated
+}
+
+// SetAction recset action applied to the selected fields
+type SetAction string
+
+const (
+	SetActionSet     SetAction = "set"     // -s, set the value of existing fields
+	SetActionAdd     SetAction = "add"     // -a, add new fields
+	SetActionSetAdd  SetAction = "set_add" // -S, set existing fields or add them
+	SetActionRename  SetAction = "rename"  // -r, rename fields
+	SetActionDelete  SetAction = "delete"  // -d, delete fields
+	SetActionComment SetAction = "comment" // -c, comment fields out
+)
+
+// SetOptions recset options
+type SetOptions struct {
+	Selection
+	Fields string    // -f, field expression such as "Email" or "Email[1]"
+	Action SetAction // action to apply to Fields
+	Value  string    // value for set, add and set_add, new name for rename
+	Force  bool      // --force, modify even if integrity would be violated
+}
+
+// args Build the selection command line arguments
+func (s Selection) args() ([]string, error) {
+	var args []string
+	if s.RecordType != "" {
+		args = append(args, "-t", s.RecordType)
+	}
+	if s.CaseInsensitive {
+		args = append(args, "-i")
+	}
+
+	selectors := 0
+	if s.Expression != "" {
+		args = append(args, "-e", s.Expression)
+		selectors++
+	}
+	if s.Quick != "" {
+		args = append(args, "-q", s.Quick)
+		selectors++
+	}
+	if s.Indexes != "" {
+		args = append(args, "-n", s.Indexes)
+		selectors++
+	}
+	if s.Random > 0 {
+		args = append(args, "-m", strconv.Itoa(s.Random))
+		selectors++
+	}
+	if selectors > 1 {
+		return nil, fmt.Errorf("only one of expression, quick, indexes and random can be used")
+	}
+	return args, nil
+}
+
+// hasSelector Report whether the selection restricts the records
+func (s Selection) hasSelector() bool {
+	return s.Expression != "" || s.Quick != "" || s.Indexes != "" || s.Random > 0
+}
+
+// countSelected Count the records matching the selection with recsel -c
+func (ro *RecordOperation) countSelected(ctx context.Context, databaseFile string, s Selection) (int, *Result, error) {
+	args, err := s.args()
+	if err != nil {
+		return 0, &Result{Success: false, Output: "", Error: err.Error()}, nil
+	}
+
+	cmd := append([]string{"recsel", "-c"}, args...)
+	cmd = append(cmd, databaseFile)
+	result, err := ro.executeRecCommand(ctx, cmd, "")
+	if err != nil || !result.Success {
+		return 0, result, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(result.Output))
+	if err != nil {
+		return 0, &Result{
+			Success: false,
+			Output:  "",
+			Error:   fmt.Sprintf("unexpected recsel count output %q", result.Output),
+		}, nil
+	}
+	return count, nil, nil
+}
+
+// RemoveRecords Delete or comment out records with recdel, letting recutils
+// enforce the database integrity rules
+func (ro *RecordOperation) RemoveRecords(ctx context.Context, databaseFile string, opts DeleteOptions) (*Result, error) {
+	if result, err := ro.checkWritable("RemoveRecords"); err != nil {
+		return result, err
+	}
+
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, false)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	if !opts.hasSelector() {
+		return &Result{
+			Success: false,
+			Output:  "",
+			Error:   "a selection (expression, quick, indexes or random) is required",
+		}, nil
+	}
+
+	args, err := opts.args()
+	if err != nil {
+		return &Result{Success: false, Output: "", Error: err.Error()}, nil
+	}
+
+	count, result, err := ro.countSelected(ctx, databaseFile, opts.Selection)
+	if result != nil {
+		return result, err
+	}
+
+	cmd := []string{"recdel"}
+	if opts.Comment {
+		cmd = append(cmd, "-c")
+	}
+	if opts.Force {
+		cmd = append(cmd, "--force")
+	}
+	cmd = append(cmd, args...)
+	cmd = append(cmd, databaseFile)
+
+	result, err = ro.executeRecCommand(ctx, cmd, "")
+	if err != nil || !result.Success {
+		return result, err
+	}
+
+	verb := "deleted"
+	if opts.Comment {
+		verb = "commented out"
+	}
+	return &Result{
+		Success:  true,
+		Output:   fmt.Sprintf("%d records %s successfully", count, verb),
+		Error:    "",
+		Affected: count,
+	}, nil
+}
+
+// SetFields Modify fields of the selected records with recset, letting
+// recutils enforce the database integrity rules
+func (ro *RecordOperation) SetFields(ctx context.Context, databaseFile string, opts SetOptions) (*Result, error) {
+	if result, err := ro.checkWritable("SetFields"); err != nil {
+		return result, err
+	}
+
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, false)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	if opts.Fields == "" {
+		return &Result{
+			Success: false,
+			Output:  "",
+			Error:   "fields is required",
+		}, nil
+	}
+
+	var action []string
+	switch opts.Action {
+	case SetActionSet:
+		action = []string{"-s", opts.Value}
+	case SetActionAdd:
+		action = []string{"-a", opts.Value}
+	case SetActionSetAdd:
+		action = []string{"-S", opts.Value}
+	case SetActionRename:
+		if opts.Value == "" {
+			return &Result{Success: false, Output: "", Error: "rename requires the new field name as value"}, nil
+		}
+		action = []string{"-r", opts.Value}
+	case SetActionDelete:
+		action = []string{"-d"}
+	case SetActionComment:
+		action = []string{"-c"}
+	default:
+		return &Result{
+			Success: false,
+			Output:  "",
+			Error:   fmt.Sprintf("unknown action %q", opts.Action),
+		}, nil
+	}
+
+	args, err := opts.args()
+	if err != nil {
+		return &Result{Success: false, Output: "", Error: err.Error()}, nil
+	}
+
+	count, result, err := ro.countSelected(ctx, databaseFile, opts.Selection)
+	if result != nil {
+		return result, err
+	}
+
+	cmd := []string{"recset"}
+	if opts.Force {
+		cmd = append(cmd, "--force")
+	}
+	cmd = append(cmd, args...)
+	cmd = append(cmd, "-f", opts.Fields)
+	cmd = append(cmd, action...)
+	cmd = append(cmd, databaseFile)
+
+	result, err = ro.executeRecCommand(ctx, cmd, "")
+	if err != nil || !result.Success {
+		return result, err
+	}
+
+	return &Result{
+		Success:  true,
+		Output:   fmt.Sprintf("%d records updated successfully", count),
+		Error:    "",
+		Affected: count,
+	}, nil
+}
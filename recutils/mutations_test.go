@@ -0,0 +1,239 @@
+// recutils package: Unit tests for recdel and recset mutations
+package recutils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSelectionArgs tests building selection arguments
+func TestSelectionArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection Selection
+		want      []string
+		wantError bool
+	}{
+		{
+			name:      "Empty selection",
+			selection: Selection{},
+			want:      nil,
+		},
+		{
+			name:      "Type and expression",
+			selection: Selection{RecordType: "Person", Expression: "Age > 30", CaseInsensitive: true},
+			want:      []string{"-t", "Person", "-i", "-e", "Age > 30"},
+		},
+		{
+			name:      "Indexes",
+			selection: Selection{Indexes: "0,2-4"},
+			want:      []string{"-n", "0,2-4"},
+		},
+		{
+			name:      "Random",
+			selection: Selection{RecordType: "Person", Random: 2},
+			want:      []string{"-t", "Person", "-m", "2"},
+		},
+		{
+			name:      "Several selectors",
+			selection: Selection{Expression: "Age > 30", Quick: "John"},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tt.selection.args()
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, args)
+			}
+		})
+	}
+}
+
+// TestMutationValidation tests option validation done before running recutils
+func TestMutationValidation(t *testing.T) {
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	t.Run("RemoveRecords without selection", func(t *testing.T) {
+		result, err := op.RemoveRecords(ctx, "test.rec", DeleteOptions{
+			Selection: Selection{RecordType: "Person"},
+		})
+		if err != nil || result == nil || result.Success {
+			t.Errorf("Expected failed result, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("SetFields without fields", func(t *testing.T) {
+		result, err := op.SetFields(ctx, "test.rec", SetOptions{Action: SetActionDelete})
+		if err != nil || result == nil || result.Success {
+			t.Errorf("Expected failed result, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("SetFields with unknown action", func(t *testing.T) {
+		result, err := op.SetFields(ctx, "test.rec", SetOptions{Fields: "Name", Action: "replace"})
+		if err != nil || result == nil || result.Success {
+			t.Errorf("Expected failed result, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("SetFields rename without name", func(t *testing.T) {
+		result, err := op.SetFields(ctx, "test.rec", SetOptions{Fields: "Name", Action: SetActionRename})
+		if err != nil || result == nil || result.Success {
+			t.Errorf("Expected failed result, got %+v, %v", result, err)
+		}
+	})
+}
+
+// TestRemoveRecordsAndSetFields tests recdel and recset against real files
+func TestRemoveRecordsAndSetFields(t *testing.T) {
+	for _, tool := range []string{"recsel", "recdel", "recset"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip("recutils not installed, skipping test")
+		}
+	}
+
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	testData := `%rec: Person
+
+Name: John Doe
+Age: 25
+
+Name: Jane Smith
+Age: 30
+
+Name: Bob Johnson
+Age: 28
+`
+
+	setup := func(t *testing.T) string {
+		testDBPath := filepath.Join(t.TempDir(), "test_mutations.rec")
+		if err := os.WriteFile(testDBPath, []byte(testData), 0644); err != nil {
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+		return testDBPath
+	}
+
+	t.Run("Delete by expression", func(t *testing.T) {
+		testDBPath := setup(t)
+
+		result, err := op.RemoveRecords(ctx, testDBPath, DeleteOptions{
+			Selection: Selection{RecordType: "Person", Expression: "Age < 30"},
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("RemoveRecords failed: %v, result: %+v", err, result)
+		}
+		if result.Affected != 2 {
+			t.Errorf("Expected 2 affected records, got %d", result.Affected)
+		}
+
+		content, _ := os.ReadFile(testDBPath)
+		if strings.Contains(string(content), "John Doe") || !strings.Contains(string(content), "Jane Smith") {
+			t.Errorf("Unexpected database content: %s", content)
+		}
+	})
+
+	t.Run("Comment out by index", func(t *testing.T) {
+		testDBPath := setup(t)
+
+		result, err := op.RemoveRecords(ctx, testDBPath, DeleteOptions{
+			Selection: Selection{RecordType: "Person", Indexes: "1"},
+			Comment:   true,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("RemoveRecords failed: %v, result: %+v", err, result)
+		}
+
+		content, _ := os.ReadFile(testDBPath)
+		if !strings.Contains(string(content), "#Name: Jane Smith") {
+			t.Errorf("Record was not commented out: %s", content)
+		}
+	})
+
+	t.Run("Set field value", func(t *testing.T) {
+		testDBPath := setup(t)
+
+		result, err := op.SetFields(ctx, testDBPath, SetOptions{
+			Selection: Selection{RecordType: "Person", Expression: "Name = 'Jane Smith'"},
+			Fields:    "Age",
+			Action:    SetActionSet,
+			Value:     "31",
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("SetFields failed: %v, result: %+v", err, result)
+		}
+		if result.Affected != 1 {
+			t.Errorf("Expected 1 affected record, got %d", result.Affected)
+		}
+
+		content, _ := os.ReadFile(testDBPath)
+		if !strings.Contains(string(content), "Name: Jane Smith\nAge: 31") {
+			t.Errorf("Field was not set: %s", content)
+		}
+	})
+
+	t.Run("Add field to every record", func(t *testing.T) {
+		testDBPath := setup(t)
+
+		result, err := op.SetFields(ctx, testDBPath, SetOptions{
+			Selection: Selection{RecordType: "Person"},
+			Fields:    "Active",
+			Action:    SetActionAdd,
+			Value:     "yes",
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("SetFields failed: %v, result: %+v", err, result)
+		}
+
+		content, _ := os.ReadFile(testDBPath)
+		if strings.Count(string(content), "Active: yes") != 3 {
+			t.Errorf("Field was not added to every record: %s", content)
+		}
+	})
+
+	t.Run("Rename and delete fields", func(t *testing.T) {
+		testDBPath := setup(t)
+
+		result, err := op.SetFields(ctx, testDBPath, SetOptions{
+			Selection: Selection{RecordType: "Person"},
+			Fields:    "Age",
+			Action:    SetActionRename,
+			Value:     "Years",
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("SetFields rename failed: %v, result: %+v", err, result)
+		}
+
+		result, err = op.SetFields(ctx, testDBPath, SetOptions{
+			Selection: Selection{RecordType: "Person", Quick: "Bob"},
+			Fields:    "Years",
+			Action:    SetActionDelete,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("SetFields delete failed: %v, result: %+v", err, result)
+		}
+
+		content, _ := os.ReadFile(testDBPath)
+		if strings.Contains(string(content), "Age:") || strings.Count(string(content), "Years:") != 2 {
+			t.Errorf("Unexpected database content: %s", content)
+		}
+	})
+}
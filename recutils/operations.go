@@ -4,9 +4,10 @@ package recutils
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"sort"
 	"strings"
 	"time"
 )
@@ -16,82 +17,193 @@ type Result struct {
 	Success bool   `json:"success"`
 	Output  string `json:"output"`
 	Error   string `json:"error"`
+	// Affected is the number of records changed by a mutation
+	Affected int `json:"affected,omitempty"`
+	// Records holds the selected records in structured query mode, each
+	// mapping a field name to its values in order of appearance
+	Records []map[string][]string `json:"records,omitempty"`
+	// TimedOut is set when a recutils command was killed for running
+	// longer than the command timeout
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Table holds the typed rows of aggregate reports
+	Table *Table `json:"table,omitempty"`
+	// Steps holds the outcome of each applied step of a transaction
+	Steps []StepResult `json:"steps,omitempty"`
+	// Schema holds the parsed record descriptors of a schema request
+	Schema []*RecordSetSchema `json:"schema,omitempty"`
+	// Diagnostics holds the integrity errors found by recfix
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// FieldErrors holds the field values rejected by their %type
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+}
+
+// failedResult Failed result carrying err, returned together with err
+func failedResult(err error) (*Result, error) {
+	return &Result{
+		Success: false,
+		Output:  "",
+		Error:   err.Error(),
+	}, err
 }
 
 // RecordOperation recutils operation interface
-type RecordOperation struct{}
+type RecordOperation struct {
+	roots                 []string      // allowed root directories, empty for no restriction
+	readOnly              bool          // reject every mutation
+	lockTimeout           time.Duration // how long to wait for a database lock
+	defaultCommandTimeout time.Duration // how long a recutils command may run
+	runner                Runner        // runs the recutils binaries
+}
+
+// Option Configure a RecordOperation
+type Option func(*RecordOperation)
 
 // NewRecordOperation Create new operation instance
-func NewRecordOperation() *RecordOperation {
-	return &RecordOperation{}
+func NewRecordOperation(opts ...Option) *RecordOperation {
+	ro := &RecordOperation{
+		lockTimeout:           DefaultLockTimeout,
+		defaultCommandTimeout: DefaultCommandTimeout,
+		runner:                &ExecRunner{},
+	}
+	for _, opt := range opts {
+		opt(ro)
+	}
+	return ro
 }
 
-// executeRecCommand Execute recutils command
+// executeRecCommand Execute recutils command with the operation's Runner.
+// The command is killed once it runs longer than the command timeout, which
+// is reported with TimedOut.
 func (ro *RecordOperation) executeRecCommand(ctx context.Context, cmd []string, inputData string) (*Result, error) {
-	var stdout, stderr bytes.Buffer
-
-	command := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
-	command.Stdout = &stdout
-	command.Stderr = &stderr
-
-	if inputData != "" {
-		command.Stdin = strings.NewReader(inputData)
+	// Set timeout
+	timeout := ro.commandTimeout(ctx)
+	cmdCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	// Set timeout
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	out, err := ro.runner.Run(cmdCtx, cmd, inputData)
+	if err != nil || out.ExitCode != 0 {
+		if ctx.Err() == nil && errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+			return &Result{
+				Success:  false,
+				Output:   out.Stdout,
+				Error:    fmt.Sprintf("%s timed out after %s", cmd[0], timeout),
+				TimedOut: true,
+			}, nil
+		}
 
-	err := command.Run()
-	if err != nil {
+		message := out.Stderr
+		if err != nil && message == "" {
+			message = err.Error()
+		}
 		return &Result{
 			Success: false,
-			Output:  stdout.String(),
-			Error:   stderr.String(),
+			Output:  out.Stdout,
+			Error:   message,
 		}, nil
 	}
 
 	return &Result{
 		Success: true,
-		Output:  strings.TrimSpace(stdout.String()),
-		Error:   strings.TrimSpace(stderr.String()),
+		Output:  strings.TrimSpace(out.Stdout),
+		Error:   strings.TrimSpace(out.Stderr),
 	}, nil
 }
 
-// QueryRecords Query records
+// QueryRecords Query records. outputFormat is passed to recsel -t and
+// selects the record type.
 func (ro *RecordOperation) QueryRecords(ctx context.Context, databaseFile, queryExpression, outputFormat string) (*Result, error) {
-	cmd := []string{"recsel"}
+	return ro.QueryRecordsWithOptions(ctx, databaseFile, QueryOptions{
+		Selection: Selection{RecordType: outputFormat, Expression: queryExpression},
+	})
+}
 
-	// Add output format (if any)
-	if outputFormat != "" {
-		cmd = append(cmd, "-t", outputFormat)
-	}
+// QueryRecordsStructured Query records and return them as field maps
+// instead of rec text
+func (ro *RecordOperation) QueryRecordsStructured(ctx context.Context, databaseFile, queryExpression, recordType string) (*Result, error) {
+	return ro.QueryRecordsWithOptions(ctx, databaseFile, QueryOptions{
+		Selection:  Selection{RecordType: recordType, Expression: queryExpression},
+		Structured: true,
+	})
+}
 
-	cmd = append(cmd, databaseFile)
+// InsertRecord Insert new record using recins command. Array values insert
+// one field per element, and fields are ordered as the record descriptor
+// declares them, then by name.
+func (ro *RecordOperation) InsertRecord(ctx context.Context, databaseFile, recordType string, fields map[string]interface{}) (*Result, error) {
+	return ro.insert(ctx, "InsertRecord", databaseFile, recordType, fieldValues(fields), true)
+}
+
+// InsertRecordFields Insert a new record with the fields in the given order.
+// Fields may repeat.
+func (ro *RecordOperation) InsertRecordFields(ctx context.Context, databaseFile, recordType string, fields []FieldValue) (*Result, error) {
+	return ro.insert(ctx, "InsertRecordFields", databaseFile, recordType, fields, false)
+}
 
-	// Add query expression (if any)
-	if queryExpression != "" {
-		cmd = append(cmd, "-e", queryExpression)
+// insert Lock the database and insert a record, see insertRecord
+func (ro *RecordOperation) insert(ctx context.Context, operation, databaseFile, recordType string, fields []FieldValue, declaredOrder bool) (*Result, error) {
+	if result, err := ro.checkWritable(operation); err != nil {
+		return result, err
 	}
 
-	return ro.executeRecCommand(ctx, cmd, "")
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	_, statErr := os.Stat(databaseFile)
+	created := errors.Is(statErr, os.ErrNotExist)
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, true)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	result, err := ro.checkedMutation(ctx, databaseFile, func(path string) (*Result, error) {
+		return ro.insertRecord(ctx, path, recordType, fields, declaredOrder)
+	})
+	if created && (err != nil || result == nil || !result.Success) {
+		// Locking created an empty file, remove it again
+		os.Remove(databaseFile)
+	}
+	return result, err
 }
 
-// InsertRecord Insert new record using recins command
-func (ro *RecordOperation) InsertRecord(ctx context.Context, databaseFile, recordType string, fields map[string]interface{}) (*Result, error) {
-	// Build record content for recins
-	var recordLines []string
-	for fieldName, fieldValue := range fields {
-		recordLines = append(recordLines, fmt.Sprintf("%s: %v", fieldName, fieldValue))
+// insertRecord Insert a record into an already locked database. With
+// declaredOrder the fields are sorted by the order of the record descriptor.
+func (ro *RecordOperation) insertRecord(ctx context.Context, databaseFile, recordType string, fields []FieldValue, declaredOrder bool) (*Result, error) {
+	if !IsValidFieldName(recordType) || strings.HasPrefix(recordType, "%") {
+		return failedResult(fmt.Errorf("invalid record type %q", recordType))
 	}
-	recordContent := strings.Join(recordLines, "\n")
+
+	// Check the fields against the descriptor before recins sees them
+	var rs *RecordSet
+	if content, err := os.ReadFile(databaseFile); err == nil {
+		if db, err := Parse(bytes.NewReader(content)); err == nil {
+			rs = db.RecordSet(recordType)
+			if declaredOrder {
+				fields = append([]FieldValue(nil), fields...)
+				sortDeclared(fields, rs)
+			}
+		}
+	}
+	if result, err := validateFields(recordType, rs, fields); result != nil {
+		return result, err
+	}
+
+	// Build record content for recins, with multi-line values encoded
+	record := encodeRecord(fields)
+	recordContent := strings.TrimSuffix(record, "\n")
 
 	// Check if database file exists or is empty
 	fileInfo, err := os.Stat(databaseFile)
 	if os.IsNotExist(err) || (err == nil && fileInfo.Size() == 0) {
 		// If file does not exist or is empty, create new record set with %rec: directive
-		content := fmt.Sprintf("%%rec: %s\n\n%s\n", recordType, recordContent)
-		err = os.WriteFile(databaseFile, []byte(content), 0644)
+		content := fmt.Sprintf("%%rec: %s\n\n%s", recordType, record)
+		err = writeFileAtomic(databaseFile, []byte(content), 0644)
 		if err != nil {
 			return &Result{
 				Success: false,
@@ -119,9 +231,10 @@ func (ro *RecordOperation) InsertRecord(ctx context.Context, databaseFile, recor
 
 	if err != nil || !result.Success {
 		return &Result{
-			Success: false,
-			Output:  result.Output,
-			Error:   result.Error,
+			Success:  false,
+			Output:   result.Output,
+			Error:    result.Error,
+			TimedOut: result.TimedOut,
 		}, err
 	}
 
@@ -132,209 +245,293 @@ func (ro *RecordOperation) InsertRecord(ctx context.Context, databaseFile, recor
 	}, nil
 }
 
-// DeleteRecords Delete records
-func (ro *RecordOperation) DeleteRecords(ctx context.Context, databaseFile, queryExpression string) (*Result, error) {
-	// Backup original file
-	backupFile := databaseFile + ".bak"
-	originalContent, err := os.ReadFile(databaseFile)
+// DeleteRecords Delete records of the given record type. Other record sets,
+// descriptors and comments are left untouched.
+func (ro *RecordOperation) DeleteRecords(ctx context.Context, databaseFile, recordType, queryExpression string) (*Result, error) {
+	if result, err := ro.checkWritable("DeleteRecords"); err != nil {
+		return result, err
+	}
+
+	databaseFile, err := ro.resolvePath(databaseFile)
 	if err != nil {
-		return &Result{
-			Success: false,
-			Output:  "",
-			Error:   err.Error(),
-		}, fmt.Errorf("failed to read database file: %w", err)
+		return failedResult(err)
 	}
 
-	err = os.WriteFile(backupFile, originalContent, 0644)
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, false)
 	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	return ro.checkedMutation(ctx, databaseFile, func(path string) (*Result, error) {
+		return ro.deleteRecords(ctx, path, recordType, queryExpression)
+	})
+}
+
+// deleteRecords Delete records from an already locked database
+func (ro *RecordOperation) deleteRecords(ctx context.Context, databaseFile, recordType, queryExpression string) (*Result, error) {
+	db, matched, result, err := ro.selectRecords(ctx, databaseFile, recordType, queryExpression)
+	if result != nil {
+		return result, err
+	}
+
+	if len(matched) == 0 {
+		return &Result{
+			Success:  true,
+			Output:   fmt.Sprintf("No records matching '%s', nothing deleted", queryExpression),
+			Error:    "",
+			Affected: 0,
+		}, nil
+	}
+
+	remove := make(map[*Record]bool, len(matched))
+	for _, record := range matched {
+		remove[record] = true
+	}
+	for _, rs := range db.RecordSets {
+		kept := rs.Records[:0]
+		for _, record := range rs.Records {
+			if !remove[record] {
+				kept = append(kept, record)
+			}
+		}
+		rs.Records = kept
+	}
+
+	if err := writeDatabase(databaseFile, db); err != nil {
 		return &Result{
 			Success: false,
 			Output:  "",
 			Error:   err.Error(),
-		}, fmt.Errorf("failed to create backup: %w", err)
+		}, err
 	}
 
-	// Extract record type declaration from original file
-	recordTypeDecl := extractRecordTypeDeclaration(string(originalContent))
+	return &Result{
+		Success:  true,
+		Output:   fmt.Sprintf("%d records matching '%s' deleted successfully", len(matched), queryExpression),
+		Error:    "",
+		Affected: len(matched),
+	}, nil
+}
 
-	// Use recsel to get records to keep
-	cmd := []string{"recsel", "-e", fmt.Sprintf("!(%s)", queryExpression), databaseFile}
-	result, err := ro.executeRecCommand(ctx, cmd, "")
+// UpdateRecords Update records of the given record type. Each matched record
+// is edited in place; other record sets, descriptors and comments are left
+// untouched. An array value replaces the fields of that name with one field
+// per element, other values are set on every field of that name.
+func (ro *RecordOperation) UpdateRecords(ctx context.Context, databaseFile, recordType, queryExpression string, fields map[string]interface{}) (*Result, error) {
+	if result, err := ro.checkWritable("UpdateRecords"); err != nil {
+		return result, err
+	}
 
-	if result.Success {
-		// Rebuild file with record type declaration
-		var output string
-		if recordTypeDecl != "" {
-			output = recordTypeDecl + "\n\n"
-		}
-		if result.Output != "" {
-			output += result.Output + "\n"
-		}
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
 
-		err = os.WriteFile(databaseFile, []byte(output), 0644)
-		if err != nil {
-			// Restore backup
-			os.WriteFile(backupFile, originalContent, 0644)
-			return &Result{
-				Success: false,
-				Output:  "",
-				Error:   err.Error(),
-			}, fmt.Errorf("failed to write database file: %w", err)
-		}
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, false)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
 
-		// Delete backup file
-		os.Remove(backupFile)
+	return ro.checkedMutation(ctx, databaseFile, func(path string) (*Result, error) {
+		return ro.updateRecords(ctx, path, recordType, queryExpression, fields)
+	})
+}
 
+// updateRecords Update records of an already locked database
+func (ro *RecordOperation) updateRecords(ctx context.Context, databaseFile, recordType, queryExpression string, fields map[string]interface{}) (*Result, error) {
+	db, matched, result, err := ro.selectRecords(ctx, databaseFile, recordType, queryExpression)
+	if result != nil {
+		return result, err
+	}
+
+	if len(matched) == 0 {
 		return &Result{
-			Success: true,
-			Output:  fmt.Sprintf("Records matching '%s' deleted successfully", queryExpression),
-			Error:   "",
+			Success:  true,
+			Output:   "No records matched, nothing updated",
+			Error:    "",
+			Affected: 0,
 		}, nil
-	} else {
-		// Restore backup
-		os.WriteFile(backupFile, originalContent, 0644)
-		os.Remove(backupFile)
-		return result, nil
 	}
-}
 
-// UpdateRecords Update records
-func (ro *RecordOperation) UpdateRecords(ctx context.Context, databaseFile, queryExpression string, fields map[string]interface{}) (*Result, error) {
-	// Get records to update
-	queryCmd := []string{"recsel", "-e", queryExpression, databaseFile}
-	queryResult, err := ro.executeRecCommand(ctx, queryCmd, "")
+	for _, rs := range setsOf(db, matched) {
+		if result, err := validateFields(rs.Type(), rs, fieldValues(fields)); result != nil {
+			return result, err
+		}
+	}
 
-	if err != nil || !queryResult.Success {
+	// Update fields of each matched record in place, in a stable order
+	names := make([]string, 0, len(fields))
+	for fieldName := range fields {
+		names = append(names, fieldName)
+	}
+	sort.Strings(names)
+
+	for _, record := range matched {
+		for _, fieldName := range names {
+			if list, ok := listValue(fields[fieldName]); ok {
+				texts := make([]string, len(list))
+				for i, v := range list {
+					texts[i] = formatValue(v)
+				}
+				record.SetAll(fieldName, texts)
+				continue
+			}
+			record.Set(fieldName, formatValue(fields[fieldName]))
+		}
+	}
+
+	if err := writeDatabase(databaseFile, db); err != nil {
 		return &Result{
 			Success: false,
 			Output:  "",
-			Error:   queryResult.Error,
+			Error:   err.Error(),
 		}, err
 	}
 
-	// Backup original file
-	backupFile := databaseFile + ".bak"
-	originalContent, err := os.ReadFile(databaseFile)
+	return &Result{
+		Success:  true,
+		Output:   fmt.Sprintf("%d records updated successfully", len(matched)),
+		Error:    "",
+		Affected: len(matched),
+	}, nil
+}
+
+// selectRecords Parse the database and locate the records of recordType
+// matching queryExpression. A non-nil Result is returned when the selection
+// failed and must be reported to the caller as is.
+func (ro *RecordOperation) selectRecords(ctx context.Context, databaseFile, recordType, queryExpression string) (*Database, []*Record, *Result, error) {
+	content, err := os.ReadFile(databaseFile)
 	if err != nil {
-		return &Result{
+		return nil, nil, &Result{
 			Success: false,
 			Output:  "",
 			Error:   err.Error(),
 		}, fmt.Errorf("failed to read database file: %w", err)
 	}
 
-	err = os.WriteFile(backupFile, originalContent, 0644)
+	cmd := []string{"recsel"}
+	if recordType != "" {
+		cmd = append(cmd, "-t", recordType)
+	}
+	cmd = append(cmd, "-e", queryExpression, databaseFile)
+
+	queryResult, err := ro.executeRecCommand(ctx, cmd, "")
+	if err != nil || !queryResult.Success {
+		return nil, nil, &Result{
+			Success:  false,
+			Output:   "",
+			Error:    queryResult.Error,
+			TimedOut: queryResult.TimedOut,
+		}, err
+	}
+
+	db, err := Parse(bytes.NewReader(content))
 	if err != nil {
-		return &Result{
+		return nil, nil, &Result{
 			Success: false,
 			Output:  "",
 			Error:   err.Error(),
-		}, fmt.Errorf("failed to create backup: %w", err)
+		}, fmt.Errorf("failed to parse database file: %w", err)
 	}
 
-	// Get non-matching records
-	keepCmd := []string{"recsel", "-e", fmt.Sprintf("!(%s)", queryExpression), databaseFile}
-	keepResult, err := ro.executeRecCommand(ctx, keepCmd, "")
-
-	if keepResult.Success {
-		// Extract record type declaration from original file
-		recordTypeDecl := extractRecordTypeDeclaration(string(originalContent))
-
-		// Build updated records
-		updatedRecords := []string{}
-		lines := strings.Split(queryResult.Output, "\n")
-		currentRecord := []string{}
-
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" {
-				currentRecord = append(currentRecord, line)
-			}
-		}
+	selected, err := Parse(strings.NewReader(queryResult.Output))
+	if err != nil {
+		return nil, nil, &Result{
+			Success: false,
+			Output:  "",
+			Error:   err.Error(),
+		}, fmt.Errorf("failed to parse recsel output: %w", err)
+	}
 
-		// Update fields
-		for i, line := range currentRecord {
-			for fieldName, fieldValue := range fields {
-				if strings.HasPrefix(line, fieldName+":") {
-					currentRecord[i] = fmt.Sprintf("%s: %v", fieldName, fieldValue)
-				} else {
-					// Check if field exists
-					exists := false
-					for _, l := range currentRecord {
-						if strings.HasPrefix(l, fieldName+":") {
-							exists = true
-							break
-						}
-					}
-					if !exists {
-						currentRecord = append(currentRecord, fmt.Sprintf("%s: %v", fieldName, fieldValue))
-					}
-				}
-			}
+	sets := db.RecordSets
+	if recordType != "" {
+		sets = nil
+		if rs := db.RecordSet(recordType); rs != nil {
+			sets = []*RecordSet{rs}
 		}
+	}
 
-		updatedRecords = currentRecord
-
-		// Write back to file with record type declaration
-		var output string
-		if recordTypeDecl != "" {
-			output = recordTypeDecl + "\n\n"
-		}
+	return db, matchRecords(sets, selected), nil, nil
+}
 
-		// Add non-matching records
-		if keepResult.Output != "" {
-			output += keepResult.Output
-			if len(updatedRecords) > 0 {
-				output += "\n\n"
+// setsOf Record sets of db containing any of records
+func setsOf(db *Database, records []*Record) []*RecordSet {
+	wanted := make(map[*Record]bool, len(records))
+	for _, record := range records {
+		wanted[record] = true
+	}
+	var sets []*RecordSet
+	for _, rs := range db.RecordSets {
+		for _, record := range rs.Records {
+			if wanted[record] {
+				sets = append(sets, rs)
+				break
 			}
 		}
+	}
+	return sets
+}
 
-		// Add updated records
-		if len(updatedRecords) > 0 {
-			output += strings.Join(updatedRecords, "\n") + "\n"
-		}
-
-		err = os.WriteFile(databaseFile, []byte(output), 0644)
-		if err != nil {
-			// Restore backup
-			os.WriteFile(backupFile, originalContent, 0644)
-			return &Result{
-				Success: false,
-				Output:  "",
-				Error:   err.Error(),
-			}, fmt.Errorf("failed to write database file: %w", err)
-		}
-
-		// Delete backup file
-		os.Remove(backupFile)
-
-		return &Result{
-			Success: true,
-			Output:  "Records updated successfully",
-			Error:   "",
-		}, nil
-	} else {
-		// Restore backup
-		os.WriteFile(backupFile, originalContent, 0644)
-		os.Remove(backupFile)
-		return keepResult, nil
+// writeDatabase Atomically replace databaseFile with db
+func writeDatabase(databaseFile string, db *Database) error {
+	if err := writeFileAtomic(databaseFile, []byte(db.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write database file: %w", err)
 	}
+	return nil
 }
 
 // GetDatabaseInfo Get database info
 func (ro *RecordOperation) GetDatabaseInfo(ctx context.Context, databaseFile string) (*Result, error) {
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockShared, false)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
 	cmd := []string{"recinf", databaseFile}
 	return ro.executeRecCommand(ctx, cmd, "")
 }
 
-// extractRecordTypeDeclaration extracts the record type declaration (e.g., "%rec: Person") from file content
-func extractRecordTypeDeclaration(content string) string {
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "%rec:") {
-			return trimmed
+// matchRecords Find the records of sets that recsel selected. Records are
+// compared by content: identical records always evaluate the same way against
+// a selection expression, so matching each selected record against the next
+// identical record in sets yields exactly the selected records, in file order.
+func matchRecords(sets []*RecordSet, selected *Database) []*Record {
+	wanted := make(map[string]int)
+	for _, rs := range selected.RecordSets {
+		for _, r := range rs.Records {
+			wanted[recordKey(r)]++
 		}
 	}
-	return ""
+
+	var matched []*Record
+	for _, rs := range sets {
+		for _, r := range rs.Records {
+			key := recordKey(r)
+			if wanted[key] > 0 {
+				wanted[key]--
+				matched = append(matched, r)
+			}
+		}
+	}
+	return matched
+}
+
+// recordKey Return a string identifying the content of a record
+func recordKey(r *Record) string {
+	var sb strings.Builder
+	for _, f := range r.Fields {
+		sb.WriteString(f.Name)
+		sb.WriteByte(0)
+		sb.WriteString(f.Value)
+		sb.WriteByte(1)
+	}
+	return sb.String()
 }
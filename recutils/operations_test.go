@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -66,19 +67,75 @@ func TestExecuteRecCommand(t *testing.T) {
 
 // TestExecuteRecCommandTimeout tests command execution timeout
 func TestExecuteRecCommandTimeout(t *testing.T) {
-	op := NewRecordOperation()
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not available, skipping test")
+	}
 
-	// Create a context that will timeout quickly
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
-	defer cancel()
+	// assertTimedOut Run cmd and check it was killed by the command timeout
+	assertTimedOut := func(t *testing.T, op *RecordOperation, ctx context.Context, cmd []string) {
+		t.Helper()
+		start := time.Now()
+		result, err := op.executeRecCommand(ctx, cmd, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Success || !result.TimedOut {
+			t.Errorf("Expected timed out result, got %+v", result)
+		}
+		if !strings.Contains(result.Error, "timed out") {
+			t.Errorf("Expected timeout error, got %q", result.Error)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Command was not killed in time, took %v", elapsed)
+		}
+	}
 
-	// Use sleep command that will exceed timeout
-	result, err := op.executeRecCommand(ctx, []string{"sleep", "10"}, "")
+	t.Run("Operation timeout", func(t *testing.T) {
+		op := NewRecordOperation(WithCommandTimeout(100 * time.Millisecond))
+		assertTimedOut(t, op, context.Background(), []string{"sleep", "10"})
+	})
 
-	// Should either return error or a failed result due to timeout
-	if err == nil && result != nil && result.Success {
-		t.Error("Expected timeout to cause failure, but command succeeded")
-	}
+	t.Run("Context override", func(t *testing.T) {
+		op := NewRecordOperation()
+		ctx := ContextWithCommandTimeout(context.Background(), 100*time.Millisecond)
+		assertTimedOut(t, op, ctx, []string{"sleep", "10"})
+	})
+
+	t.Run("Child process keeps output open", func(t *testing.T) {
+		op := NewRecordOperation(WithCommandTimeout(100 * time.Millisecond))
+		assertTimedOut(t, op, context.Background(), []string{"sh", "-c", "sleep 10 & sleep 10"})
+	})
+
+	t.Run("Fast command", func(t *testing.T) {
+		op := NewRecordOperation(WithCommandTimeout(5 * time.Second))
+		result, err := op.executeRecCommand(context.Background(), []string{"echo", "test"}, "")
+		if err != nil || !result.Success || result.TimedOut {
+			t.Errorf("Expected success, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("Disabled timeout", func(t *testing.T) {
+		op := NewRecordOperation(WithCommandTimeout(0))
+		result, err := op.executeRecCommand(context.Background(), []string{"sleep", "0.2"}, "")
+		if err != nil || !result.Success {
+			t.Errorf("Expected success, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("Canceled caller context", func(t *testing.T) {
+		op := NewRecordOperation()
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+		defer cancel()
+
+		result, err := op.executeRecCommand(ctx, []string{"sleep", "10"}, "")
+		if err == nil && result != nil && result.Success {
+			t.Error("Expected timeout to cause failure, but command succeeded")
+		}
+		// The caller gave up, the command itself did not time out
+		if result != nil && result.TimedOut {
+			t.Error("Caller cancellation should not be reported as command timeout")
+		}
+	})
 }
 
 // TestQueryRecords tests the QueryRecords method
@@ -233,6 +290,73 @@ City: Los Angeles
 	}
 }
 
+// TestQueryRecordsStructured tests structured query results
+func TestQueryRecordsStructured(t *testing.T) {
+	if _, err := exec.LookPath("recsel"); err != nil {
+		t.Skip("recutils not installed, skipping test")
+	}
+
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	testDBPath := filepath.Join(tmpDir, "test_structured.rec")
+	testData := `%rec: Person
+
+Name: John Doe
+Email: john@example.com
+Email: jd@example.com
+
+Name: Jane Smith
+Notes: first line
++ second line
+`
+	err := os.WriteFile(testDBPath, []byte(testData), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	t.Run("All records", func(t *testing.T) {
+		result, err := op.QueryRecordsStructured(ctx, testDBPath, "", "")
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("QueryRecordsStructured failed: %v, result: %+v", err, result)
+		}
+
+		if len(result.Records) != 2 {
+			t.Fatalf("Expected 2 records, got %d", len(result.Records))
+		}
+		if emails := result.Records[0]["Email"]; len(emails) != 2 || emails[1] != "jd@example.com" {
+			t.Errorf("Repeated fields not preserved: %v", emails)
+		}
+		if notes := result.Records[1]["Notes"]; len(notes) != 1 || notes[0] != "first line\nsecond line" {
+			t.Errorf("Multi-line value not decoded: %v", notes)
+		}
+		if result.Output != "" {
+			t.Errorf("Expected no raw output in structured mode, got %q", result.Output)
+		}
+	})
+
+	t.Run("Filtered records", func(t *testing.T) {
+		result, err := op.QueryRecordsStructured(ctx, testDBPath, "Name = 'Jane Smith'", "")
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("QueryRecordsStructured failed: %v, result: %+v", err, result)
+		}
+		if len(result.Records) != 1 || result.Records[0]["Name"][0] != "Jane Smith" {
+			t.Errorf("Unexpected records: %v", result.Records)
+		}
+	})
+
+	t.Run("Non-existent database file", func(t *testing.T) {
+		result, err := op.QueryRecordsStructured(ctx, filepath.Join(tmpDir, "missing.rec"), "", "")
+		if err != nil {
+			t.Errorf("QueryRecordsStructured returned error: %v", err)
+		}
+		if result == nil || result.Success {
+			t.Error("Expected success=false for non-existent file")
+		}
+	})
+}
+
 // TestInsertRecord tests the InsertRecord method
 func TestInsertRecord(t *testing.T) {
 	op := NewRecordOperation()
@@ -407,7 +531,7 @@ City: Chicago
 			t.Fatalf("Failed to create test database: %v", err)
 		}
 
-		result, err := op.DeleteRecords(ctx, testDBPath, "Name = 'Jane Smith'")
+		result, err := op.DeleteRecords(ctx, testDBPath, "Person", "Name = 'Jane Smith'")
 		if err != nil {
 			t.Errorf("DeleteRecords returned error: %v", err)
 			return
@@ -453,7 +577,7 @@ City: Chicago
 			t.Fatalf("Failed to recreate test database: %v", err)
 		}
 
-		result, err := op.DeleteRecords(ctx, testDBPath, "Age < 30")
+		result, err := op.DeleteRecords(ctx, testDBPath, "Person", "Age < 30")
 		if err != nil {
 			t.Errorf("DeleteRecords returned error: %v", err)
 			return
@@ -488,7 +612,7 @@ City: New York
 			t.Fatalf("Failed to recreate test database: %v", err)
 		}
 
-		result, err := op.DeleteRecords(ctx, testDBPath, "Name = 'NonExistent'")
+		result, err := op.DeleteRecords(ctx, testDBPath, "Person", "Name = 'NonExistent'")
 		if err != nil {
 			t.Errorf("DeleteRecords returned error: %v", err)
 			return
@@ -499,11 +623,59 @@ City: New York
 		}
 	})
 
+	t.Run("Delete from one of several record sets", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testDBPath := filepath.Join(tmpDir, "test_delete_sets.rec")
+
+		testData := `%rec: Person
+%key: Name
+%type: Age int
+%mandatory: Name
+
+# Staff
+Name: John Doe
+Age: 25
+
+Name: Jane Smith
+Age: 30
+
+%rec: Project
+%doc: Projects and their owners
+
+Name: Apollo
+Owner: John Doe
+
+Name: Gemini
+Owner: Jane Smith
+`
+
+		err := os.WriteFile(testDBPath, []byte(testData), 0644)
+		if err != nil {
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+
+		result, err := op.DeleteRecords(ctx, testDBPath, "Project", "Name = 'Apollo'")
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("DeleteRecords failed: %v, result: %+v", err, result)
+		}
+
+		if result.Affected != 1 {
+			t.Errorf("Expected 1 affected record, got %d", result.Affected)
+		}
+
+		// Descriptors, comments and the Person set must be preserved
+		want := strings.Replace(testData, "Name: Apollo\nOwner: John Doe\n\n", "", 1)
+		content, _ := os.ReadFile(testDBPath)
+		if string(content) != want {
+			t.Errorf("Unexpected database content.\nwant: %q\ngot:  %q", want, string(content))
+		}
+	})
+
 	t.Run("Delete from non-existent file", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		nonExistentPath := filepath.Join(tmpDir, "nonexistent.rec")
 
-		result, err := op.DeleteRecords(ctx, nonExistentPath, "Name = 'Test'")
+		result, err := op.DeleteRecords(ctx, nonExistentPath, "Person", "Name = 'Test'")
 		// DeleteRecords returns error for non-existent file
 		if err == nil {
 			t.Error("Expected error for non-existent file")
@@ -540,7 +712,7 @@ City: Los Angeles
 			t.Fatalf("Failed to create test database: %v", err)
 		}
 
-		result, err := op.UpdateRecords(ctx, testDBPath, "Name = 'John Doe'", map[string]interface{}{
+		result, err := op.UpdateRecords(ctx, testDBPath, "Person", "Name = 'John Doe'", map[string]interface{}{
 			"Age": 26,
 		})
 		if err != nil {
@@ -586,7 +758,7 @@ City: Los Angeles
 			t.Fatalf("Failed to create test database: %v", err)
 		}
 
-		result, err := op.UpdateRecords(ctx, testDBPath, "Name = 'Jane Smith'", map[string]interface{}{
+		result, err := op.UpdateRecords(ctx, testDBPath, "Person", "Name = 'Jane Smith'", map[string]interface{}{
 			"Age":  31,
 			"City": "San Francisco",
 		})
@@ -632,7 +804,7 @@ City: Los Angeles
 			t.Fatalf("Failed to create test database: %v", err)
 		}
 
-		result, err := op.UpdateRecords(ctx, testDBPath, "Name = 'John Doe'", map[string]interface{}{
+		result, err := op.UpdateRecords(ctx, testDBPath, "Person", "Name = 'John Doe'", map[string]interface{}{
 			"Email": "john.doe@example.com",
 		})
 		if err != nil {
@@ -653,6 +825,168 @@ City: Los Angeles
 		}
 	})
 
+	t.Run("Update multiple matching records", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testDBPath := filepath.Join(tmpDir, "test_update_many.rec")
+
+		testData := `%rec: Person
+
+Name: John Doe
+Age: 25
+City: New York
+
+# Jane moved recently
+Name: Jane Smith
+Age: 30
+City: New York
+
+Name: Bob Johnson
+Age: 28
+City: Chicago
+
+Name: Alice Brown
+Age: 35
+City: New York
+`
+
+		err := os.WriteFile(testDBPath, []byte(testData), 0644)
+		if err != nil {
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+
+		result, err := op.UpdateRecords(ctx, testDBPath, "Person", "City = 'New York'", map[string]interface{}{
+			"City":  "Boston",
+			"State": "MA",
+		})
+		if err != nil {
+			t.Fatalf("UpdateRecords returned error: %v", err)
+		}
+
+		if result == nil || !result.Success {
+			t.Fatalf("Expected success=true, got result: %+v", result)
+		}
+
+		if result.Affected != 3 {
+			t.Errorf("Expected 3 affected records, got %d", result.Affected)
+		}
+
+		// Every record keeps its position and separators; only matches change
+		want := `%rec: Person
+
+Name: John Doe
+Age: 25
+City: Boston
+State: MA
+
+# Jane moved recently
+Name: Jane Smith
+Age: 30
+City: Boston
+State: MA
+
+Name: Bob Johnson
+Age: 28
+City: Chicago
+
+Name: Alice Brown
+Age: 35
+City: Boston
+State: MA
+`
+		content, _ := os.ReadFile(testDBPath)
+		if string(content) != want {
+			t.Errorf("Unexpected database content.\nwant: %q\ngot:  %q", want, string(content))
+		}
+	})
+
+	t.Run("Update identical records", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testDBPath := filepath.Join(tmpDir, "test_update_identical.rec")
+
+		testData := `%rec: Task
+
+Title: Review
+Done: no
+
+Title: Deploy
+Done: no
+
+Title: Review
+Done: no
+`
+
+		err := os.WriteFile(testDBPath, []byte(testData), 0644)
+		if err != nil {
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+
+		result, err := op.UpdateRecords(ctx, testDBPath, "Task", "Title = 'Review'", map[string]interface{}{
+			"Done": "yes",
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("UpdateRecords failed: %v, result: %+v", err, result)
+		}
+
+		if result.Affected != 2 {
+			t.Errorf("Expected 2 affected records, got %d", result.Affected)
+		}
+
+		content, _ := os.ReadFile(testDBPath)
+		if strings.Count(string(content), "Done: yes") != 2 || !strings.Contains(string(content), "Title: Deploy\nDone: no") {
+			t.Errorf("Unexpected database content: %q", string(content))
+		}
+	})
+
+	t.Run("Update one of several record sets", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		testDBPath := filepath.Join(tmpDir, "test_update_sets.rec")
+
+		testData := `%rec: Person
+%key: Name
+%type: Age int
+%mandatory: Name
+
+# Staff
+Name: John Doe
+Age: 25
+
+Name: Jane Smith
+Age: 30
+
+%rec: Project
+%doc: Projects and their owners
+
+Name: Apollo
+Owner: John Doe
+
+Name: Gemini
+Owner: Jane Smith
+`
+
+		err := os.WriteFile(testDBPath, []byte(testData), 0644)
+		if err != nil {
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+
+		// Both sets have a record named John Doe or owned by him; only Person changes
+		result, err := op.UpdateRecords(ctx, testDBPath, "Person", "Name = 'John Doe'", map[string]interface{}{
+			"Age": 26,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("UpdateRecords failed: %v, result: %+v", err, result)
+		}
+
+		if result.Affected != 1 {
+			t.Errorf("Expected 1 affected record, got %d", result.Affected)
+		}
+
+		want := strings.Replace(testData, "Name: John Doe\nAge: 25", "Name: John Doe\nAge: 26", 1)
+		content, _ := os.ReadFile(testDBPath)
+		if string(content) != want {
+			t.Errorf("Unexpected database content.\nwant: %q\ngot:  %q", want, string(content))
+		}
+	})
+
 	t.Run("Update non-matching record", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		testDBPath := filepath.Join(tmpDir, "test_update_nomatch.rec")
@@ -669,7 +1003,7 @@ City: New York
 			t.Fatalf("Failed to create test database: %v", err)
 		}
 
-		result, err := op.UpdateRecords(ctx, testDBPath, "Name = 'NonExistent'", map[string]interface{}{
+		result, err := op.UpdateRecords(ctx, testDBPath, "Person", "Name = 'NonExistent'", map[string]interface{}{
 			"Age": 99,
 		})
 		if err != nil {
@@ -687,7 +1021,7 @@ City: New York
 		tmpDir := t.TempDir()
 		nonExistentPath := filepath.Join(tmpDir, "nonexistent.rec")
 
-		result, err := op.UpdateRecords(ctx, nonExistentPath, "Name = 'Test'", map[string]interface{}{
+		result, err := op.UpdateRecords(ctx, nonExistentPath, "Person", "Name = 'Test'", map[string]interface{}{
 			"Age": 25,
 		})
 		// UpdateRecords returns Result with Success=false for non-existent file
@@ -705,6 +1039,44 @@ City: New York
 	})
 }
 
+// TestMatchRecords tests locating recsel output records in a parsed database
+func TestMatchRecords(t *testing.T) {
+	db, err := Parse(strings.NewReader(`%rec: Person
+
+Name: A
+Age: 1
+
+Name: B
+Age: 2
+
+Name: A
+Age: 1
+
+Name: C
+Age: 1
+`))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	selected, err := Parse(strings.NewReader("Name: A\nAge: 1\n\nName: A\nAge: 1\n\nName: C\nAge: 1\n"))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	matched := matchRecords(db.RecordSets, selected)
+	records := db.RecordSets[0].Records
+	want := []*Record{records[0], records[2], records[3]}
+	if len(matched) != len(want) {
+		t.Fatalf("Expected %d matched records, got %d", len(want), len(matched))
+	}
+	for i := range want {
+		if matched[i] != want[i] {
+			t.Errorf("Match %d points to the wrong record", i)
+		}
+	}
+}
+
 // TestGetDatabaseInfo tests the GetDatabaseInfo method
 func TestGetDatabaseInfo(t *testing.T) {
 	// Create temporary test database
@@ -0,0 +1,393 @@
+// recutils package: Native parser for the rec file format
+package recutils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Database Parsed rec file, made of one or more record sets
+type Database struct {
+	RecordSets []*RecordSet
+
+	head    string // blank lines and detached comments before the first record
+	trailer string // blank lines and detached comments after the last record
+}
+
+// RecordSet Records sharing the same record descriptor
+type RecordSet struct {
+	// Descriptor is the %rec record heading the set, or nil for records that
+	// appear before any descriptor in the file
+	Descriptor *Record
+	Records    []*Record
+}
+
+// Record Sequence of fields separated from other records by blank lines
+type Record struct {
+	Fields []*Field
+	// Line is the 1-based line number of the first field, 0 for new records
+	Line int
+
+	lead string // separator text preceding the record (blank lines, detached comments)
+	tail string // comment lines following the last field
+}
+
+// Field Single name/value pair of a record
+type Field struct {
+	Name  string
+	Value string
+	// Line is the 1-based line number of the field name, 0 for new fields
+	Line int
+
+	comments  string // comment lines immediately preceding the field
+	raw       string // original text of the field, continuation lines included
+	origName  string
+	origValue string
+}
+
+// ParseError Syntax error found while parsing a rec file
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// NewField Create a field that is not backed by any parsed text
+func NewField(name, value string) *Field {
+	return &Field{Name: name, Value: value}
+}
+
+// Type Return the record type declared by the descriptor, or "" for the
+// anonymous record set
+func (rs *RecordSet) Type() string {
+	if rs.Descriptor == nil {
+		return ""
+	}
+	value, _ := rs.Descriptor.Get("%rec")
+	if parts := strings.Fields(value); len(parts) > 0 {
+		return parts[0]
+	}
+	return ""
+}
+
+// Key Return the name of the %key field declared by the descriptor, or ""
+func (rs *RecordSet) Key() string {
+	if rs.Descriptor == nil {
+		return ""
+	}
+	value, _ := rs.Descriptor.Get("%key")
+	if parts := strings.Fields(value); len(parts) > 0 {
+		return parts[0]
+	}
+	return ""
+}
+
+// Lookup Return the record whose %key field has the given value, or nil if
+// there is none or the set has no key
+func (rs *RecordSet) Lookup(key string) *Record {
+	name := rs.Key()
+	if name == "" {
+		return nil
+	}
+	for _, r := range rs.Records {
+		if value, ok := r.Get(name); ok && value == key {
+			return r
+		}
+	}
+	return nil
+}
+
+// RecordSet Return the record set of the given type, or nil if there is none.
+// An empty type selects the anonymous record set.
+func (db *Database) RecordSet(recordType string) *RecordSet {
+	for _, rs := range db.RecordSets {
+		if rs.Type() == recordType {
+			return rs
+		}
+	}
+	return nil
+}
+
+// Get Return the value of the first field with the given name
+func (r *Record) Get(name string) (string, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll Return the values of every field with the given name, in order
+func (r *Record) GetAll(name string) []string {
+	var values []string
+	for _, f := range r.Fields {
+		if f.Name == name {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Set Set the value of every field with the given name, appending a new field
+// if the record has none
+func (r *Record) Set(name, value string) {
+	found := false
+	for _, f := range r.Fields {
+		if f.Name == name {
+			f.Value = value
+			found = true
+		}
+	}
+	if !found {
+		r.Fields = append(r.Fields, NewField(name, value))
+	}
+}
+
+// SetAll Replace the fields with the given name by one field per value.
+// Existing fields are reused in order, further values are inserted after the
+// last of them and surplus fields are removed. Without existing fields the
+// values are appended.
+func (r *Record) SetAll(name string, values []string) {
+	fields := make([]*Field, 0, len(r.Fields)+len(values))
+	next, last := 0, -1
+	for _, f := range r.Fields {
+		if f.Name != name {
+			fields = append(fields, f)
+			continue
+		}
+		if next < len(values) {
+			f.Value = values[next]
+			next++
+			fields = append(fields, f)
+			last = len(fields) - 1
+		}
+	}
+
+	added := make([]*Field, 0, len(values)-next)
+	for _, value := range values[next:] {
+		added = append(added, NewField(name, value))
+	}
+	if last < 0 {
+		fields = append(fields, added...)
+	} else {
+		fields = append(fields[:last+1], append(added, fields[last+1:]...)...)
+	}
+	r.Fields = fields
+}
+
+// Map Return the record fields keyed by name. Values of repeated fields are
+// kept in order of appearance.
+func (r *Record) Map() map[string][]string {
+	m := make(map[string][]string, len(r.Fields))
+	for _, f := range r.Fields {
+		m[f.Name] = append(m[f.Name], f.Value)
+	}
+	return m
+}
+
+// IsDescriptor Report whether the record is a %rec descriptor
+func (r *Record) IsDescriptor() bool {
+	_, ok := r.Get("%rec")
+	return ok
+}
+
+// Parse Parse a rec file into a Database
+func Parse(r io.Reader) (*Database, error) {
+	p := &parser{db: &Database{}}
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			p.lineNo++
+			if perr := p.parseLine(reader, line); perr != nil {
+				return nil, perr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rec data: %w", err)
+		}
+	}
+
+	p.finish()
+	return p.db, nil
+}
+
+// parser Line oriented state machine used by Parse
+type parser struct {
+	db     *Database
+	lineNo int
+
+	current  *Record // record being built, nil between records
+	pending  string  // separator text not yet attached to a record
+	comments string  // comment lines not yet attached to a field
+	seenAny  bool    // whether a record has been completed or started
+}
+
+func (p *parser) parseLine(reader *bufio.Reader, line string) error {
+	content := strings.TrimRight(line, "\n")
+
+	switch {
+	case strings.TrimSpace(content) == "":
+		p.endRecord()
+		if p.comments != "" {
+			// Comments followed by a blank line are detached from any record
+			p.pending += p.comments
+			p.comments = ""
+		}
+		p.pending += line
+
+	case strings.HasPrefix(content, "#"):
+		p.comments += line
+
+	case strings.HasPrefix(content, "+"):
+		if p.current == nil || len(p.current.Fields) == 0 || p.comments != "" {
+			return &ParseError{Line: p.lineNo, Message: "continuation line without a preceding field"}
+		}
+		raw, text, err := p.readContinued(reader, line)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimPrefix(text, "+")
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			text = text[1:]
+		}
+		f := p.current.Fields[len(p.current.Fields)-1]
+		f.Value += "\n" + text
+		f.origValue = f.Value
+		f.raw += raw
+
+	default:
+		startLine := p.lineNo
+		raw, text, err := p.readContinued(reader, line)
+		if err != nil {
+			return err
+		}
+		name, value, ok := splitField(text)
+		if !ok {
+			return &ParseError{Line: startLine, Message: fmt.Sprintf("invalid field %q", content)}
+		}
+		if p.current == nil {
+			p.current = &Record{Line: startLine}
+			if p.seenAny {
+				p.current.lead = p.pending
+			} else {
+				p.db.head = p.pending
+			}
+			p.pending = ""
+			p.seenAny = true
+		}
+		p.current.Fields = append(p.current.Fields, &Field{
+			Name:      name,
+			Value:     value,
+			Line:      startLine,
+			comments:  p.comments,
+			raw:       raw,
+			origName:  name,
+			origValue: value,
+		})
+		p.comments = ""
+	}
+
+	return nil
+}
+
+// readContinued Join physical lines ending with a backslash into one logical
+// line, returning the raw text consumed and the joined content. Only the
+// backslash directly before a line break joins lines, so "a\\" followed by
+// an empty line is the value "a\".
+func (p *parser) readContinued(reader *bufio.Reader, line string) (string, string, error) {
+	raw := line
+	physical := strings.TrimRight(line, "\n")
+	text := physical
+	for strings.HasSuffix(physical, "\\") && strings.HasSuffix(raw, "\n") {
+		next, err := reader.ReadString('\n')
+		if next == "" {
+			if err != nil && err != io.EOF {
+				return "", "", fmt.Errorf("failed to read rec data: %w", err)
+			}
+			// A line break escaped at the end of the data joins an empty line
+			text = text[:len(text)-1]
+			break
+		}
+		p.lineNo++
+		raw += next
+		physical = strings.TrimRight(next, "\n")
+		text = text[:len(text)-1] + physical
+	}
+	return raw, text, nil
+}
+
+// endRecord Close the record being built, if any
+func (p *parser) endRecord() {
+	if p.current == nil {
+		return
+	}
+	r := p.current
+	p.current = nil
+	r.tail = p.comments
+	p.comments = ""
+
+	if r.IsDescriptor() {
+		p.db.RecordSets = append(p.db.RecordSets, &RecordSet{Descriptor: r})
+		return
+	}
+	if len(p.db.RecordSets) == 0 {
+		p.db.RecordSets = append(p.db.RecordSets, &RecordSet{})
+	}
+	rs := p.db.RecordSets[len(p.db.RecordSets)-1]
+	rs.Records = append(rs.Records, r)
+}
+
+func (p *parser) finish() {
+	p.endRecord()
+	p.pending += p.comments
+	p.comments = ""
+	if p.seenAny {
+		p.db.trailer = p.pending
+	} else {
+		p.db.head = p.pending
+	}
+	p.pending = ""
+}
+
+// splitField Split a "Name: value" line into its name and value
+func splitField(text string) (string, string, bool) {
+	colon := strings.IndexByte(text, ':')
+	if colon <= 0 {
+		return "", "", false
+	}
+	name := text[:colon]
+	if !IsValidFieldName(name) {
+		return "", "", false
+	}
+	value := strings.TrimLeft(text[colon+1:], " \t")
+	return name, value, true
+}
+
+// IsValidFieldName Report whether name is a valid rec field name. Special
+// fields of record descriptors start with '%'.
+func IsValidFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i == 0 && c == '%':
+		case i > 0 && (c >= '0' && c <= '9' || c == '_'):
+		default:
+			return false
+		}
+	}
+	return name != "%"
+}
@@ -0,0 +1,360 @@
+// recutils package: Unit tests for the native rec parser and writer
+package recutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestParseRoundTrip tests that unmodified databases are written back byte-for-byte
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "Empty file",
+			data: "",
+		},
+		{
+			name: "Single record set",
+			data: `%rec: Person
+
+Name: John Doe
+Age: 25
+
+Name: Jane Smith
+Age: 30
+`,
+		},
+		{
+			name: "Multiple record sets with descriptors",
+			data: `%rec: Person
+%key: Id
+%type: Age int
+%mandatory: Name
+
+Id: 1
+Name: John Doe
+Age: 25
+
+%rec: Project
+%doc: Projects owned by people
+
+Title: recutils-mcp
+Owner: 1
+`,
+		},
+		{
+			name: "Comments everywhere",
+			data: `# Header comment
+
+# Another detached comment
+%rec: Person
+
+# Comment before a record
+Name: John Doe
+# Comment between fields
+Age: 25
+# Comment after the last field
+
+# Detached comment between records
+
+Name: Jane Smith
+
+# Trailing comment
+`,
+		},
+		{
+			name: "Multi-line values",
+			data: `%rec: Note
+
+Title: Shopping
+Body: eggs
++ milk
++
++ bread
+Long: first part \
+second part
+`,
+		},
+		{
+			name: "Records without descriptor",
+			data: `Name: anonymous
+
+%rec: Person
+
+Name: typed
+`,
+		},
+		{
+			name: "Unusual spacing",
+			data: "\n\nName:John\nAge:\t25\n\n\n\nName:  Jane\n\n",
+		},
+		{
+			name: "No trailing newline",
+			data: "%rec: Person\n\nName: John",
+		},
+		{
+			name: "Only comments",
+			data: "# nothing here\n# yet\n",
+		},
+		{
+			name: "Whitespace separator",
+			data: "Name: a\n \nName: b\n\t\n\nName: c\n",
+		},
+		{
+			name: "Whitespace before first record",
+			data: "%rec: Person\n  \nName: a\n",
+		},
+		{
+			name: "CRLF line endings",
+			data: "%rec: Person\r\n\r\nName: a\r\nAge: 1\r\n\r\nName: b\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Parse(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+
+			var sb strings.Builder
+			n, err := db.WriteTo(&sb)
+			if err != nil {
+				t.Fatalf("WriteTo returned error: %v", err)
+			}
+			if sb.String() != tt.data {
+				t.Errorf("Round trip mismatch.\nwant: %q\ngot:  %q", tt.data, sb.String())
+			}
+			if n != int64(len(tt.data)) {
+				t.Errorf("Expected %d bytes written, got %d", len(tt.data), n)
+			}
+		})
+	}
+}
+
+// TestParseStructure tests the parsed representation of a database
+func TestParseStructure(t *testing.T) {
+	data := `# People and projects
+%rec: Person
+%key: Id
+
+Id: 1
+Name: John Doe
+# Work address
+Email: john@example.com
+Email: jd@example.com
+Notes: line one
++ line two
++ line three
+
+Id: 2
+Name: Jane Smith
+
+%rec: Project Projects.rec
+
+Title: recutils-mcp
+`
+
+	db, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	if len(db.RecordSets) != 2 {
+		t.Fatalf("Expected 2 record sets, got %d", len(db.RecordSets))
+	}
+
+	people := db.RecordSet("Person")
+	if people == nil {
+		t.Fatal("Person record set not found")
+	}
+	if people.Type() != "Person" {
+		t.Errorf("Expected type Person, got %q", people.Type())
+	}
+	if key, _ := people.Descriptor.Get("%key"); key != "Id" {
+		t.Errorf("Expected %%key Id, got %q", key)
+	}
+	if len(people.Records) != 2 {
+		t.Fatalf("Expected 2 Person records, got %d", len(people.Records))
+	}
+
+	john := people.Records[0]
+	if john.Line != 5 {
+		t.Errorf("Expected record to start on line 5, got %d", john.Line)
+	}
+	if emails := john.GetAll("Email"); len(emails) != 2 || emails[1] != "jd@example.com" {
+		t.Errorf("Expected two Email fields, got %v", emails)
+	}
+	if notes, _ := john.Get("Notes"); notes != "line one\nline two\nline three" {
+		t.Errorf("Unexpected multi-line value %q", notes)
+	}
+	if len(john.Fields) != 5 {
+		t.Errorf("Comments must not be parsed as fields, got %d fields", len(john.Fields))
+	}
+
+	projects := db.RecordSet("Project")
+	if projects == nil || len(projects.Records) != 1 {
+		t.Fatal("Project record set not parsed correctly")
+	}
+	if db.RecordSet("Missing") != nil {
+		t.Error("Expected nil for unknown record type")
+	}
+}
+
+// TestRecordMap tests converting records to field maps
+func TestRecordMap(t *testing.T) {
+	db, err := Parse(strings.NewReader("Name: John\nEmail: a@example.com\nEmail: b@example.com\nNotes: x\n+ y\n"))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	m := db.RecordSets[0].Records[0].Map()
+	if len(m) != 3 {
+		t.Errorf("Expected 3 keys, got %v", m)
+	}
+	if emails := m["Email"]; len(emails) != 2 || emails[0] != "a@example.com" || emails[1] != "b@example.com" {
+		t.Errorf("Repeated fields not preserved in order: %v", emails)
+	}
+	if notes := m["Notes"]; len(notes) != 1 || notes[0] != "x\ny" {
+		t.Errorf("Unexpected multi-line value: %v", notes)
+	}
+}
+
+// TestParseBackslashContinuation tests physical lines joined by a trailing backslash
+func TestParseBackslashContinuation(t *testing.T) {
+	db, err := Parse(strings.NewReader("Long: abc\\\ndef\\\nghi\nNext: x\n"))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	r := db.RecordSets[0].Records[0]
+	if v, _ := r.Get("Long"); v != "abcdefghi" {
+		t.Errorf("Expected joined value, got %q", v)
+	}
+	if next, _ := r.Get("Next"); next != "x" || r.Fields[1].Line != 4 {
+		t.Errorf("Line numbers not tracked across continuations: %+v", r.Fields[1])
+	}
+}
+
+// TestParseErrors tests syntax errors reported by Parse
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		line int
+	}{
+		{name: "Line without colon", data: "Name: ok\nbroken line\n", line: 2},
+		{name: "Invalid field name", data: "\n1Name: x\n", line: 2},
+		{name: "Continuation without field", data: "+ orphan\n", line: 1},
+		{name: "Continuation after comment", data: "Name: x\n# c\n+ y\n", line: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.data))
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Expected ParseError, got %v", err)
+			}
+			if perr.Line != tt.line {
+				t.Errorf("Expected error on line %d, got %d", tt.line, perr.Line)
+			}
+		})
+	}
+}
+
+// TestWriteModifiedDatabase tests writing databases changed after parsing
+func TestWriteModifiedDatabase(t *testing.T) {
+	data := `%rec: Person
+
+# John
+Name: John Doe
+Age: 25
+
+Name: Jane Smith
+Age: 30
+`
+
+	t.Run("Change field value", func(t *testing.T) {
+		db, _ := Parse(strings.NewReader(data))
+		db.RecordSets[0].Records[1].Fields[1].Value = "31"
+
+		want := strings.Replace(data, "Age: 30", "Age: 31", 1)
+		if got := db.String(); got != want {
+			t.Errorf("Unexpected output.\nwant: %q\ngot:  %q", want, got)
+		}
+	})
+
+	t.Run("Append record and field", func(t *testing.T) {
+		db, _ := Parse(strings.NewReader(data))
+		rs := db.RecordSets[0]
+		rs.Records[0].Fields = append(rs.Records[0].Fields, NewField("Notes", "a\nb"))
+		rs.Records = append(rs.Records, &Record{Fields: []*Field{NewField("Name", "Bob")}})
+
+		want := `%rec: Person
+
+# John
+Name: John Doe
+Age: 25
+Notes: a
++ b
+
+Name: Jane Smith
+Age: 30
+
+Name: Bob
+`
+		if got := db.String(); got != want {
+			t.Errorf("Unexpected output.\nwant: %q\ngot:  %q", want, got)
+		}
+	})
+
+	t.Run("Remove first record", func(t *testing.T) {
+		db, _ := Parse(strings.NewReader("Name: a\n\nName: b\n"))
+		db.RecordSets[0].Records = db.RecordSets[0].Records[1:]
+
+		if got := db.String(); got != "Name: b\n" {
+			t.Errorf("Unexpected output %q", got)
+		}
+	})
+
+	t.Run("Whitespace separators are kept", func(t *testing.T) {
+		db, _ := Parse(strings.NewReader("Name: a\n \nName: b\r\n\r\nName: c\n"))
+		db.RecordSets[0].Records[2].Fields[0].Value = "d"
+
+		if got := db.String(); got != "Name: a\n \nName: b\r\n\r\nName: d\n" {
+			t.Errorf("Unexpected output %q", got)
+		}
+	})
+
+	t.Run("Append to file without trailing newline", func(t *testing.T) {
+		db, _ := Parse(strings.NewReader("Name: a"))
+		rs := db.RecordSets[0]
+		rs.Records = append(rs.Records, &Record{Fields: []*Field{NewField("Name", "b")}})
+
+		if got := db.String(); got != "Name: a\n\nName: b\n" {
+			t.Errorf("Unexpected output %q", got)
+		}
+	})
+}
+
+// TestIsValidFieldName tests field name validation
+func TestIsValidFieldName(t *testing.T) {
+	valid := []string{"Name", "a", "First_Name", "Field2", "%rec", "%mandatory"}
+	invalid := []string{"", "%", "2Field", "_x", "Na me", "Name:", "Ñame", "a%b"}
+
+	for _, name := range valid {
+		if !IsValidFieldName(name) {
+			t.Errorf("Expected %q to be valid", name)
+		}
+	}
+	for _, name := range invalid {
+		if IsValidFieldName(name) {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+}
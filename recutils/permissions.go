@@ -0,0 +1,44 @@
+// recutils package: Read-only mode
+package recutils
+
+import (
+	"fmt"
+	"os"
+)
+
+// PermissionError Mutation rejected because the operation is read-only. It
+// matches os.ErrPermission with errors.Is.
+type PermissionError struct {
+	Operation string // rejected method, e.g. "InsertRecord"
+}
+
+// Error Implement the error interface
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: %s is not allowed in read-only mode", e.Operation)
+}
+
+// Unwrap Make the error match os.ErrPermission
+func (e *PermissionError) Unwrap() error {
+	return os.ErrPermission
+}
+
+// WithReadOnly Reject every mutation with a *PermissionError
+func WithReadOnly() Option {
+	return func(ro *RecordOperation) {
+		ro.readOnly = true
+	}
+}
+
+// ReadOnly Report whether mutations are rejected
+func (ro *RecordOperation) ReadOnly() bool {
+	return ro.readOnly
+}
+
+// checkWritable Return a failed result and a *PermissionError for the
+// operation in read-only mode, nil otherwise
+func (ro *RecordOperation) checkWritable(operation string) (*Result, error) {
+	if !ro.readOnly {
+		return nil, nil
+	}
+	return failedResult(&PermissionError{Operation: operation})
+}
@@ -0,0 +1,66 @@
+// recutils package: Unit tests for read-only mode
+package recutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReadOnlyRejectsMutations tests that mutations fail with a PermissionError
+func TestReadOnlyRejectsMutations(t *testing.T) {
+	op := NewRecordOperation(WithReadOnly())
+	ctx := context.Background()
+
+	testDBPath := filepath.Join(t.TempDir(), "test_readonly.rec")
+	testData := "%rec: Person\n\nName: John Doe\nAge: 25\n"
+	if err := os.WriteFile(testDBPath, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	calls := map[string]func() (*Result, error){
+		"InsertRecord": func() (*Result, error) {
+			return op.InsertRecord(ctx, testDBPath, "Person", map[string]interface{}{"Name": "x"})
+		},
+		"DeleteRecords": func() (*Result, error) {
+			return op.DeleteRecords(ctx, testDBPath, "Person", "Name = 'John Doe'")
+		},
+		"UpdateRecords": func() (*Result, error) {
+			return op.UpdateRecords(ctx, testDBPath, "Person", "Name = 'John Doe'", map[string]interface{}{"Age": 26})
+		},
+		"RemoveRecords": func() (*Result, error) {
+			return op.RemoveRecords(ctx, testDBPath, DeleteOptions{Selection: Selection{Indexes: "0"}})
+		},
+		"SetFields": func() (*Result, error) {
+			return op.SetFields(ctx, testDBPath, SetOptions{Fields: "Age", Action: SetActionDelete})
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			result, err := call()
+
+			var perr *PermissionError
+			if !errors.As(err, &perr) || perr.Operation != name {
+				t.Fatalf("Expected PermissionError for %s, got %v", name, err)
+			}
+			if !errors.Is(err, os.ErrPermission) {
+				t.Error("PermissionError should match os.ErrPermission")
+			}
+			if result == nil || result.Success {
+				t.Errorf("Expected failed result, got %+v", result)
+			}
+
+			content, _ := os.ReadFile(testDBPath)
+			if string(content) != testData {
+				t.Errorf("Database was modified: %q", content)
+			}
+		})
+	}
+
+	if !op.ReadOnly() || NewRecordOperation().ReadOnly() {
+		t.Error("ReadOnly does not reflect the option")
+	}
+}
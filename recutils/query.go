@@ -0,0 +1,100 @@
+// recutils package: recsel queries with projection, sorting and grouping
+package recutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// QueryOptions recsel options
+type QueryOptions struct {
+	Selection
+	Fields     []string // -p, fields to print, e.g. "Name" or "Email[0]"
+	ValuesOnly bool     // -P instead of -p, print values without field names
+	Sort       []string // -S, fields to sort by
+	GroupBy    []string // -G, fields to group by
+	Unique     bool     // -U, remove duplicated fields in each record
+	Count      bool     // -c, print the number of matching records only
+	Structured bool     // return records as field maps instead of rec text
+}
+
+// args Build the recsel command line
+func (o QueryOptions) args(databaseFile string) ([]string, error) {
+	selection, err := o.Selection.args()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := append([]string{"recsel"}, selection...)
+	if len(o.Fields) > 0 {
+		// Values only output cannot be parsed back into records
+		if o.ValuesOnly && !o.Structured {
+			cmd = append(cmd, "-P", strings.Join(o.Fields, ","))
+		} else {
+			cmd = append(cmd, "-p", strings.Join(o.Fields, ","))
+		}
+	}
+	if len(o.Sort) > 0 {
+		cmd = append(cmd, "-S", strings.Join(o.Sort, ","))
+	}
+	if len(o.GroupBy) > 0 {
+		cmd = append(cmd, "-G", strings.Join(o.GroupBy, ","))
+	}
+	if o.Unique {
+		cmd = append(cmd, "-U")
+	}
+	if o.Count {
+		cmd = append(cmd, "-c")
+	}
+	return append(cmd, databaseFile), nil
+}
+
+// QueryRecordsWithOptions Query records with the full set of recsel options
+func (ro *RecordOperation) QueryRecordsWithOptions(ctx context.Context, databaseFile string, opts QueryOptions) (*Result, error) {
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockShared, false)
+	if err != nil {
+		return failedResult(err)
+	}
+	defer unlock()
+
+	cmd, err := opts.args(databaseFile)
+	if err != nil {
+		return &Result{Success: false, Output: "", Error: err.Error()}, nil
+	}
+
+	result, err := ro.executeRecCommand(ctx, cmd, "")
+	if err != nil || !result.Success || !opts.Structured || opts.Count {
+		return result, err
+	}
+
+	// Output is trimmed; restore the final line break so that a value ending
+	// with an escaped backslash decodes the same as in the database
+	selected, err := Parse(strings.NewReader(result.Output + "\n"))
+	if err != nil {
+		return &Result{
+			Success: false,
+			Output:  "",
+			Error:   err.Error(),
+		}, fmt.Errorf("failed to parse recsel output: %w", err)
+	}
+
+	records := []map[string][]string{}
+	for _, rs := range selected.RecordSets {
+		for _, record := range rs.Records {
+			records = append(records, record.Map())
+		}
+	}
+
+	return &Result{
+		Success: true,
+		Output:  "",
+		Error:   result.Error,
+		Records: records,
+	}, nil
+}
@@ -0,0 +1,172 @@
+// recutils package: Unit tests for recsel queries with options
+package recutils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestQueryOptionsArgs tests building recsel command lines
+func TestQueryOptionsArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      QueryOptions
+		want      []string
+		wantError bool
+	}{
+		{
+			name: "No options",
+			opts: QueryOptions{},
+			want: []string{"recsel", "db.rec"},
+		},
+		{
+			name: "Projection and sorting",
+			opts: QueryOptions{
+				Selection: Selection{RecordType: "Person", Expression: "Age > 30"},
+				Fields:    []string{"Name", "Email[0]"},
+				Sort:      []string{"Age", "Name"},
+			},
+			want: []string{"recsel", "-t", "Person", "-e", "Age > 30", "-p", "Name,Email[0]", "-S", "Age,Name", "db.rec"},
+		},
+		{
+			name: "Values only",
+			opts: QueryOptions{Fields: []string{"Name"}, ValuesOnly: true},
+			want: []string{"recsel", "-P", "Name", "db.rec"},
+		},
+		{
+			name: "Values only is ignored in structured mode",
+			opts: QueryOptions{Fields: []string{"Name"}, ValuesOnly: true, Structured: true},
+			want: []string{"recsel", "-p", "Name", "db.rec"},
+		},
+		{
+			name: "Grouping, unique and count",
+			opts: QueryOptions{
+				Selection: Selection{Quick: "doe", CaseInsensitive: true},
+				GroupBy:   []string{"City"},
+				Unique:    true,
+				Count:     true,
+			},
+			want: []string{"recsel", "-i", "-q", "doe", "-G", "City", "-U", "-c", "db.rec"},
+		},
+		{
+			name:      "Indexes and random are exclusive",
+			opts:      QueryOptions{Selection: Selection{Indexes: "0", Random: 1}},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tt.opts.args("db.rec")
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, args)
+			}
+		})
+	}
+}
+
+// TestQueryRecordsWithOptions tests recsel options against a real database
+func TestQueryRecordsWithOptions(t *testing.T) {
+	if _, err := exec.LookPath("recsel"); err != nil {
+		t.Skip("recutils not installed, skipping test")
+	}
+
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	testDBPath := filepath.Join(t.TempDir(), "test_options.rec")
+	testData := `%rec: Person
+
+Name: John Doe
+Age: 35
+City: Boston
+
+Name: Jane Smith
+Age: 30
+City: Denver
+
+Name: Bob Johnson
+Age: 28
+City: Boston
+`
+	if err := os.WriteFile(testDBPath, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	t.Run("Sorted projection", func(t *testing.T) {
+		result, err := op.QueryRecordsWithOptions(ctx, testDBPath, QueryOptions{
+			Fields:     []string{"Name"},
+			Sort:       []string{"Age"},
+			Structured: true,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("Query failed: %v, result: %+v", err, result)
+		}
+
+		var names []string
+		for _, record := range result.Records {
+			if _, ok := record["Age"]; ok {
+				t.Errorf("Age should not be projected: %v", record)
+			}
+			names = append(names, record["Name"][0])
+		}
+		want := []string{"Bob Johnson", "Jane Smith", "John Doe"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("Expected %v, got %v", want, names)
+		}
+	})
+
+	t.Run("Values only", func(t *testing.T) {
+		result, err := op.QueryRecordsWithOptions(ctx, testDBPath, QueryOptions{
+			Selection:  Selection{Expression: "City = 'Boston'"},
+			Fields:     []string{"Name"},
+			ValuesOnly: true,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("Query failed: %v, result: %+v", err, result)
+		}
+		if strings.Contains(result.Output, "Name:") || !strings.Contains(result.Output, "Bob Johnson") {
+			t.Errorf("Unexpected output %q", result.Output)
+		}
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		result, err := op.QueryRecordsWithOptions(ctx, testDBPath, QueryOptions{
+			Selection: Selection{Quick: "Boston"},
+			Count:     true,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("Query failed: %v, result: %+v", err, result)
+		}
+		if result.Output != "2" {
+			t.Errorf("Expected count 2, got %q", result.Output)
+		}
+	})
+
+	t.Run("Indexes", func(t *testing.T) {
+		result, err := op.QueryRecordsWithOptions(ctx, testDBPath, QueryOptions{
+			Selection:  Selection{Indexes: "0,2"},
+			Structured: true,
+		})
+		if err != nil || result == nil || !result.Success {
+			t.Fatalf("Query failed: %v, result: %+v", err, result)
+		}
+		if len(result.Records) != 2 || result.Records[1]["Name"][0] != "Bob Johnson" {
+			t.Errorf("Unexpected records %v", result.Records)
+		}
+	})
+}
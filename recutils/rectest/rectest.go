@@ -0,0 +1,132 @@
+// rectest package: Recording and replaying recutils runners, so code built
+// on recutils.RecordOperation can be tested without recutils installed
+package rectest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// Call Command run by a RecordOperation and its output
+type Call struct {
+	Argv   []string           `json:"argv"`
+	Stdin  string             `json:"stdin,omitempty"`
+	Output recutils.RunOutput `json:"output"`
+}
+
+// Recorder Runner that passes commands to another Runner and records them
+type Recorder struct {
+	runner recutils.Runner
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder Record the commands run by runner
+func NewRecorder(runner recutils.Runner) *Recorder {
+	return &Recorder{runner: runner}
+}
+
+// Run Run the command and record it. Commands that failed to run are not
+// recorded.
+func (r *Recorder) Run(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+	out, err := r.runner.Run(ctx, argv, stdin)
+	if err != nil {
+		return out, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Argv: slices.Clone(argv), Stdin: stdin, Output: out})
+	return out, nil
+}
+
+// Calls Commands recorded so far, in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.calls)
+}
+
+// Save Write the recorded commands to a JSON file that Load reads
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Calls(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Replayer Runner that answers commands from recorded calls instead of
+// running them. Each call answers one command with the same argv and stdin;
+// identical commands are answered by identical calls in recorded order.
+type Replayer struct {
+	mu    sync.Mutex
+	calls []Call
+	used  []bool
+}
+
+// NewReplayer Replay the given calls
+func NewReplayer(calls ...Call) *Replayer {
+	r := &Replayer{}
+	for _, call := range calls {
+		r.Add(call)
+	}
+	return r
+}
+
+// Load Replay the calls saved by Recorder.Save
+func Load(path string) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var calls []Call
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil, fmt.Errorf("rectest: invalid recording %s: %w", path, err)
+	}
+	return NewReplayer(calls...), nil
+}
+
+// Add Add a call to replay
+func (r *Replayer) Add(call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+	r.used = append(r.used, false)
+}
+
+// Run Answer the command with the first unused matching call. Commands
+// without one fail like a missing binary.
+func (r *Replayer) Run(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, call := range r.calls {
+		if !r.used[i] && slices.Equal(call.Argv, argv) && call.Stdin == stdin {
+			r.used[i] = true
+			return call.Output, nil
+		}
+	}
+	return recutils.RunOutput{ExitCode: -1}, fmt.Errorf("rectest: unexpected command %q", argv)
+}
+
+// Remaining Calls that have not been replayed yet
+func (r *Replayer) Remaining() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var remaining []Call
+	for i, call := range r.calls {
+		if !r.used[i] {
+			remaining = append(remaining, call)
+		}
+	}
+	return remaining
+}
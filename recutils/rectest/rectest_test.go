@@ -0,0 +1,124 @@
+// rectest package: Unit tests for recording and replaying runners
+package rectest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// TestRecordAndReplay tests saving recorded commands and replaying them
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+
+	runs := 0
+	recorder := NewRecorder(recutils.RunnerFunc(func(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+		runs++
+		return recutils.RunOutput{Stdout: argv[0] + " output"}, nil
+	}))
+	recorder.Run(ctx, []string{"recsel", "db.rec"}, "")
+	recorder.Run(ctx, []string{"recinf", "db.rec"}, "stdin")
+
+	path := filepath.Join(t.TempDir(), "calls.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	replayer, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	out, err := replayer.Run(ctx, []string{"recinf", "db.rec"}, "stdin")
+	if err != nil || out.Stdout != "recinf output" {
+		t.Errorf("Unexpected replay %+v, %v", out, err)
+	}
+	if remaining := replayer.Remaining(); len(remaining) != 1 || remaining[0].Argv[0] != "recsel" {
+		t.Errorf("Unexpected remaining calls %+v", remaining)
+	}
+	if _, err := replayer.Run(ctx, []string{"recinf", "db.rec"}, "stdin"); err == nil {
+		t.Error("Expected error when replaying a call twice")
+	}
+	if _, err := replayer.Run(ctx, []string{"recsel", "other.rec"}, ""); err == nil {
+		t.Error("Expected error for unexpected command")
+	}
+	if runs != 2 {
+		t.Errorf("Replaying must not run commands, runs = %d", runs)
+	}
+}
+
+// TestReplayRecordOperation tests a RecordOperation answered by a Replayer
+func TestReplayRecordOperation(t *testing.T) {
+	replayer := NewReplayer(
+		Call{
+			Argv:   []string{"recsel", "-t", "Task", "-p", "Project,Sum(Hours)", "-G", "Project", "tasks.rec"},
+			Output: recutils.RunOutput{Stdout: "Project: alpha\nSum_Hours: 5\n\nProject: beta\nSum_Hours: 2.5\n"},
+		},
+	)
+	op := recutils.NewRecordOperation(recutils.WithRunner(replayer))
+
+	result, err := op.Aggregate(context.Background(), "tasks.rec", recutils.AggregateOptions{
+		Selection:  recutils.Selection{RecordType: "Task"},
+		GroupBy:    []string{"Project"},
+		Aggregates: []recutils.AggregateSpec{{Function: "Sum", Field: "Hours"}},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("Aggregate failed: %v, %+v", err, result)
+	}
+
+	want := [][]any{{"alpha", 5.0}, {"beta", 2.5}}
+	if !reflect.DeepEqual(result.Table.Rows, want) {
+		t.Errorf("Expected rows %v, got %v", want, result.Table.Rows)
+	}
+	if remaining := replayer.Remaining(); len(remaining) != 0 {
+		t.Errorf("Calls not replayed: %+v", remaining)
+	}
+}
+
+// TestReplayMutation tests replaying a mutation recorded on the working copy
+func TestReplayMutation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "people.rec")
+	original := "%rec: Person\n\nName: John Doe\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// recins appends the record to the file it is given, recfix accepts it
+	recorder := NewRecorder(recutils.RunnerFunc(func(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+		if argv[0] == "recins" {
+			file := argv[len(argv)-1]
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return recutils.RunOutput{}, err
+			}
+			return recutils.RunOutput{}, os.WriteFile(file, append(content, "\nName: Jane Doe\n"...), 0644)
+		}
+		return recutils.RunOutput{}, nil
+	}))
+	op := recutils.NewRecordOperation(recutils.WithRunner(recorder))
+	if result, err := op.InsertRecord(ctx, path, "Person", map[string]interface{}{"Name": "Jane Doe"}); err != nil || !result.Success {
+		t.Fatalf("InsertRecord failed: %v, %+v", err, result)
+	}
+	calls := recorder.Calls()
+	if len(calls) != 2 || calls[0].Argv[0] != "recins" || calls[1].Argv[0] != "recfix" {
+		t.Fatalf("Expected recins and recfix to be recorded, got %+v", calls)
+	}
+
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewReplayer(calls...)
+	op = recutils.NewRecordOperation(recutils.WithRunner(replayer))
+	if result, err := op.InsertRecord(ctx, path, "Person", map[string]interface{}{"Name": "Jane Doe"}); err != nil || !result.Success {
+		t.Fatalf("Replayed InsertRecord failed: %v, %+v", err, result)
+	}
+	// The replayed recins leaves the working copy unchanged, so there is
+	// nothing for recfix to check
+	if remaining := replayer.Remaining(); len(remaining) != 1 || remaining[0].Argv[0] != "recfix" {
+		t.Errorf("Expected recins to be replayed, remaining calls %+v", remaining)
+	}
+}
@@ -0,0 +1,97 @@
+// recutils package: Pluggable execution of recutils commands
+package recutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Runner Run a command line such as {"recsel", "-t", "Person", "db.rec"}.
+// A command that ran and exited with a non-zero status is reported through
+// ExitCode; the error is reserved for commands that could not be started or
+// were killed because ctx ended.
+type Runner interface {
+	Run(ctx context.Context, argv []string, stdin string) (RunOutput, error)
+}
+
+// RunOutput Output of a finished command
+type RunOutput struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// RunnerFunc Adapt an ordinary function to the Runner interface
+type RunnerFunc func(ctx context.Context, argv []string, stdin string) (RunOutput, error)
+
+// Run Call f
+func (f RunnerFunc) Run(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+	return f(ctx, argv, stdin)
+}
+
+// ExecRunner Runner that executes commands with os/exec. It is the default
+// Runner of a RecordOperation.
+type ExecRunner struct {
+	// BinDir is the directory binaries are run from. Binaries are looked up
+	// in PATH when it is empty.
+	BinDir string
+}
+
+// Run Execute argv and wait for it to exit
+func (r *ExecRunner) Run(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+	var stdout, stderr bytes.Buffer
+
+	name := argv[0]
+	if r.BinDir != "" && filepath.Base(name) == name {
+		name = filepath.Join(r.BinDir, name)
+	}
+	command := exec.CommandContext(ctx, name, argv[1:]...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	// Do not wait for children that inherited the output pipes once killed
+	command.WaitDelay = time.Second
+
+	if stdin != "" {
+		command.Stdin = strings.NewReader(stdin)
+	}
+
+	err := command.Run()
+	out := RunOutput{Stdout: stdout.String(), Stderr: stderr.String()}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		out.ExitCode = exitErr.ExitCode()
+		return out, nil
+	}
+	if err != nil {
+		out.ExitCode = -1
+		return out, err
+	}
+	return out, nil
+}
+
+// LookPath Locate the binary that Run would execute for name
+func (r *ExecRunner) LookPath(name string) (string, error) {
+	if r.BinDir != "" && filepath.Base(name) == name {
+		name = filepath.Join(r.BinDir, name)
+	}
+	return exec.LookPath(name)
+}
+
+// WithRunner Run recutils commands with r instead of os/exec
+func WithRunner(r Runner) Option {
+	return func(ro *RecordOperation) {
+		ro.runner = r
+	}
+}
+
+// WithBinDir Run the recutils binaries found in dir instead of PATH, e.g. to
+// pin a specific recutils build
+func WithBinDir(dir string) Option {
+	return WithRunner(&ExecRunner{BinDir: dir})
+}
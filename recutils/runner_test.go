@@ -0,0 +1,96 @@
+// recutils package: Unit tests for command runners
+package recutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestExecRunner tests running commands with os/exec
+func TestExecRunner(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available, skipping test")
+	}
+	ctx := context.Background()
+	r := &ExecRunner{}
+
+	t.Run("Output and exit code", func(t *testing.T) {
+		out, err := r.Run(ctx, []string{"sh", "-c", "echo out; echo err >&2; exit 3"}, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := RunOutput{Stdout: "out\n", Stderr: "err\n", ExitCode: 3}
+		if out != want {
+			t.Errorf("Expected %+v, got %+v", want, out)
+		}
+	})
+
+	t.Run("Stdin", func(t *testing.T) {
+		out, err := r.Run(ctx, []string{"cat"}, "Name: x\n")
+		if err != nil || out.Stdout != "Name: x\n" || out.ExitCode != 0 {
+			t.Errorf("Unexpected output %+v, %v", out, err)
+		}
+	})
+
+	t.Run("Missing binary", func(t *testing.T) {
+		if _, err := r.Run(ctx, []string{"recutils-mcp-no-such-binary"}, ""); err == nil {
+			t.Error("Expected error but got none")
+		}
+	})
+
+	t.Run("Binary directory", func(t *testing.T) {
+		dir := t.TempDir()
+		script := "#!/bin/sh\necho pinned \"$@\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "recsel"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		op := NewRecordOperation(WithBinDir(dir))
+		result, err := op.executeRecCommand(ctx, []string{"recsel", "-c", "db.rec"}, "")
+		if err != nil || !result.Success || result.Output != "pinned -c db.rec" {
+			t.Errorf("Expected pinned recsel to run, got %+v, %v", result, err)
+		}
+	})
+}
+
+// TestExecuteRecCommandRunner tests how runner outcomes map to results
+func TestExecuteRecCommandRunner(t *testing.T) {
+	ctx := context.Background()
+
+	var gotArgv []string
+	var gotStdin string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		gotArgv, gotStdin = argv, stdin
+		switch argv[0] {
+		case "recsel":
+			return RunOutput{Stdout: "Name: x\n\n"}, nil
+		case "recins":
+			return RunOutput{Stderr: "recins: error: invalid record\n", ExitCode: 1}, nil
+		default:
+			return RunOutput{ExitCode: -1}, errors.New("not found")
+		}
+	})))
+
+	result, err := op.executeRecCommand(ctx, []string{"recsel", "db.rec"}, "input")
+	if err != nil || !result.Success || result.Output != "Name: x" {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+	if !reflect.DeepEqual(gotArgv, []string{"recsel", "db.rec"}) || gotStdin != "input" {
+		t.Errorf("Runner got %q with stdin %q", gotArgv, gotStdin)
+	}
+
+	result, err = op.executeRecCommand(ctx, []string{"recins", "db.rec"}, "")
+	if err != nil || result.Success || result.Error != "recins: error: invalid record\n" {
+		t.Errorf("Expected failed result with stderr, got %+v, %v", result, err)
+	}
+
+	result, err = op.executeRecCommand(ctx, []string{"recfix", "db.rec"}, "")
+	if err != nil || result.Success || result.Error != "not found" {
+		t.Errorf("Expected failed result with runner error, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,116 @@
+// recutils package: Confine database files to configured root directories
+package recutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot Database file resolves outside every configured root
+var ErrOutsideRoot = errors.New("database file is outside the allowed root directories")
+
+// WithRoots Restrict database files to the given root directories. Relative
+// database paths are resolved against the first root. Without roots any path
+// the process can access is allowed.
+func WithRoots(roots ...string) Option {
+	return func(ro *RecordOperation) {
+		ro.roots = append(ro.roots, roots...)
+	}
+}
+
+// Roots Configured root directories
+func (ro *RecordOperation) Roots() []string {
+	return append([]string(nil), ro.roots...)
+}
+
+// ResolvePath Resolve a database path the way every operation does before
+// touching the file, see resolvePath
+func (ro *RecordOperation) ResolvePath(databaseFile string) (string, error) {
+	return ro.resolvePath(databaseFile)
+}
+
+// CanonicalPath Resolve a database path as ResolvePath does, then make it
+// absolute with every existing symlink resolved. Relative, absolute and
+// symlinked forms of a path give the same result, so it is the form to
+// compare paths in, e.g. against access lists.
+func (ro *RecordOperation) CanonicalPath(databaseFile string) (string, error) {
+	resolved, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return "", err
+	}
+	return evalExistingSymlinks(resolved)
+}
+
+// resolvePath Resolve a database path against the configured roots. Paths
+// with ".." elements and paths whose symlinks lead outside every root are
+// rejected. The returned path has all symlinks resolved, so recutils and
+// file writes act on the file that was checked.
+func (ro *RecordOperation) resolvePath(databaseFile string) (string, error) {
+	if len(ro.roots) == 0 {
+		return databaseFile, nil
+	}
+	if databaseFile == "" {
+		return "", fmt.Errorf("%w: empty path", ErrOutsideRoot)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(databaseFile), "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%w: %s contains \"..\"", ErrOutsideRoot, databaseFile)
+		}
+	}
+
+	path := databaseFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ro.roots[0], path)
+	}
+	resolved, err := evalExistingSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range ro.roots {
+		realRoot, err := evalExistingSymlinks(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(realRoot, resolved)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return resolved, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrOutsideRoot, databaseFile)
+}
+
+// evalExistingSymlinks Make path absolute and resolve the symlinks of its
+// longest existing prefix. The missing remainder, e.g. a database file that
+// is about to be created, is appended unchanged.
+func evalExistingSymlinks(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		// A dangling symlink would be followed when the file is created
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", fmt.Errorf("%w: dangling symlink %s", ErrOutsideRoot, path)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
@@ -0,0 +1,147 @@
+// recutils package: Unit tests for database root directory restriction
+package recutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolvePath tests resolving database paths against the roots
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	realRoot, _ := filepath.EvalSymlinks(root)
+	realOutside, _ := filepath.EvalSymlinks(outside)
+
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "inner")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing.rec"), filepath.Join(root, "dangling.rec")); err != nil {
+		t.Fatal(err)
+	}
+
+	op := NewRecordOperation(WithRoots(root))
+
+	tests := []struct {
+		name      string
+		path      string
+		want      string
+		wantError bool
+	}{
+		{name: "Relative path", path: "db.rec", want: filepath.Join(realRoot, "db.rec")},
+		{name: "Relative path in new directory", path: "new/db.rec", want: filepath.Join(realRoot, "new", "db.rec")},
+		{name: "Absolute path inside root", path: filepath.Join(root, "sub", "db.rec"), want: filepath.Join(realRoot, "sub", "db.rec")},
+		{name: "Symlink inside root", path: "inner/db.rec", want: filepath.Join(realRoot, "sub", "db.rec")},
+		{name: "Dot dot traversal", path: "../db.rec", wantError: true},
+		{name: "Dot dot staying inside root", path: "sub/../db.rec", wantError: true},
+		{name: "Absolute path outside root", path: filepath.Join(outside, "db.rec"), wantError: true},
+		{name: "Symlink escape", path: "escape/db.rec", wantError: true},
+		{name: "Dangling symlink", path: "dangling.rec", wantError: true},
+		{name: "Root itself", path: root, wantError: true},
+		{name: "Empty path", path: "", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := op.resolvePath(tt.path)
+			if tt.wantError {
+				if !errors.Is(err, ErrOutsideRoot) {
+					t.Errorf("Expected ErrOutsideRoot, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Second root", func(t *testing.T) {
+		op := NewRecordOperation(WithRoots(root, outside))
+		got, err := op.resolvePath(filepath.Join(outside, "db.rec"))
+		if err != nil || got != filepath.Join(realOutside, "db.rec") {
+			t.Errorf("Expected path in second root, got %q, %v", got, err)
+		}
+	})
+
+	t.Run("No roots", func(t *testing.T) {
+		got, err := NewRecordOperation().resolvePath("../db.rec")
+		if err != nil || got != "../db.rec" {
+			t.Errorf("Expected path unchanged, got %q, %v", got, err)
+		}
+	})
+
+	t.Run("Canonical path without roots", func(t *testing.T) {
+		op := NewRecordOperation()
+		got, err := op.CanonicalPath(filepath.Join(root, "inner", "db.rec"))
+		if err != nil || got != filepath.Join(realRoot, "sub", "db.rec") {
+			t.Errorf("Expected symlinks resolved, got %q, %v", got, err)
+		}
+		wd, _ := os.Getwd()
+		realWd, _ := filepath.EvalSymlinks(wd)
+		if got, err := op.CanonicalPath("db.rec"); err != nil || got != filepath.Join(realWd, "db.rec") {
+			t.Errorf("Expected absolute path, got %q, %v", got, err)
+		}
+	})
+}
+
+// TestOperationsRejectOutsideRoot tests that no operation touches files outside the roots
+func TestOperationsRejectOutsideRoot(t *testing.T) {
+	op := NewRecordOperation(WithRoots(t.TempDir()))
+	ctx := context.Background()
+	target := filepath.Join(t.TempDir(), "db.rec")
+
+	calls := map[string]func() (*Result, error){
+		"QueryRecords": func() (*Result, error) {
+			return op.QueryRecords(ctx, target, "", "")
+		},
+		"InsertRecord": func() (*Result, error) {
+			return op.InsertRecord(ctx, target, "Person", map[string]interface{}{"Name": "x"})
+		},
+		"DeleteRecords": func() (*Result, error) {
+			return op.DeleteRecords(ctx, target, "Person", "Name = 'x'")
+		},
+		"UpdateRecords": func() (*Result, error) {
+			return op.UpdateRecords(ctx, target, "Person", "Name = 'x'", map[string]interface{}{"Name": "y"})
+		},
+		"RemoveRecords": func() (*Result, error) {
+			return op.RemoveRecords(ctx, target, DeleteOptions{Selection: Selection{Expression: "Name = 'x'"}})
+		},
+		"SetFields": func() (*Result, error) {
+			return op.SetFields(ctx, target, SetOptions{Fields: "Name", Action: SetActionDelete})
+		},
+		"Aggregate": func() (*Result, error) {
+			return op.Aggregate(ctx, target, AggregateOptions{Aggregates: []AggregateSpec{{Function: "Count", Field: "Name"}}})
+		},
+		"GetDatabaseInfo": func() (*Result, error) {
+			return op.GetDatabaseInfo(ctx, target)
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			result, err := call()
+			if !errors.Is(err, ErrOutsideRoot) {
+				t.Errorf("Expected ErrOutsideRoot, got %v", err)
+			}
+			if result == nil || result.Success {
+				t.Errorf("Expected failed result, got %+v", result)
+			}
+			if _, err := os.Stat(target); !os.IsNotExist(err) {
+				t.Errorf("File outside root was created")
+			}
+		})
+	}
+}
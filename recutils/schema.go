@@ -0,0 +1,281 @@
+// recutils package: Parsed record descriptors
+package recutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldType Parsed %type or %typedef type description
+type FieldType struct {
+	// Kind is int, bool, real, range, size, line, regexp, date, enum, field,
+	// email, uuid or rec, empty when the type names an undefined typedef
+	Kind        string   `json:"kind"`
+	Typedef     string   `json:"typedef,omitempty"` // typedef the type was declared with
+	Min         *int64   `json:"min,omitempty"`     // lower bound of a range, nil for MIN
+	Max         *int64   `json:"max,omitempty"`     // upper bound of a range, nil for MAX
+	Size        int      `json:"size,omitempty"`    // maximum length of a size type
+	Regexp      string   `json:"regexp,omitempty"`  // pattern of a regexp type
+	Values      []string `json:"values,omitempty"`  // allowed values of an enum
+	Record      string   `json:"record,omitempty"`  // record type referenced by a rec type
+	Description string   `json:"description"`       // type description as written
+}
+
+// SizeConstraint Parsed %size, e.g. "<= 10"
+type SizeConstraint struct {
+	Operator string `json:"operator"` // ==, <, <=, > or >=
+	Count    int    `json:"count"`
+}
+
+// RecordSetSchema Parsed descriptor of a record set
+type RecordSetSchema struct {
+	Type         string                `json:"type"`
+	Doc          string                `json:"doc,omitempty"`
+	Key          string                `json:"key,omitempty"`
+	Mandatory    []string              `json:"mandatory,omitempty"`
+	Allowed      []string              `json:"allowed,omitempty"`
+	Prohibit     []string              `json:"prohibit,omitempty"`
+	Unique       []string              `json:"unique,omitempty"`
+	Auto         []string              `json:"auto,omitempty"`
+	Sort         []string              `json:"sort,omitempty"`
+	Confidential []string              `json:"confidential,omitempty"`
+	Size         *SizeConstraint       `json:"size,omitempty"`
+	Constraints  []string              `json:"constraints,omitempty"`
+	Types        map[string]*FieldType `json:"types,omitempty"`    // by field name
+	Typedefs     map[string]*FieldType `json:"typedefs,omitempty"` // by type name
+	RecordCount  int                   `json:"record_count"`
+}
+
+// Schema Parse the descriptor of the record set. Field lists of repeated
+// special fields are joined; malformed entries are skipped.
+func (rs *RecordSet) Schema() *RecordSetSchema {
+	schema := &RecordSetSchema{Type: rs.Type(), RecordCount: len(rs.Records)}
+	if rs.Descriptor == nil {
+		return schema
+	}
+
+	typedefs := map[string]string{}
+	types := map[string]string{}
+	for _, f := range rs.Descriptor.Fields {
+		value := strings.TrimSpace(f.Value)
+		switch f.Name {
+		case "%doc":
+			schema.Doc = value
+		case "%key":
+			schema.Key = firstWord(value)
+		case "%mandatory":
+			schema.Mandatory = append(schema.Mandatory, strings.Fields(value)...)
+		case "%allowed":
+			schema.Allowed = append(schema.Allowed, strings.Fields(value)...)
+		case "%prohibit":
+			schema.Prohibit = append(schema.Prohibit, strings.Fields(value)...)
+		case "%unique":
+			schema.Unique = append(schema.Unique, strings.Fields(value)...)
+		case "%auto":
+			schema.Auto = append(schema.Auto, strings.Fields(value)...)
+		case "%sort":
+			schema.Sort = append(schema.Sort, strings.Fields(value)...)
+		case "%confidential":
+			schema.Confidential = append(schema.Confidential, strings.Fields(value)...)
+		case "%constraint":
+			schema.Constraints = append(schema.Constraints, value)
+		case "%size":
+			schema.Size = parseSize(value)
+		case "%typedef":
+			if name, description, ok := cutWord(value); ok {
+				typedefs[name] = description
+			}
+		case "%type":
+			// A comma separated field list followed by the type description
+			if fields, description, ok := cutWord(value); ok {
+				for _, field := range strings.Split(fields, ",") {
+					if field = strings.TrimSpace(field); field != "" {
+						types[field] = description
+					}
+				}
+			}
+		}
+	}
+
+	if len(typedefs) > 0 {
+		schema.Typedefs = map[string]*FieldType{}
+		for name, description := range typedefs {
+			schema.Typedefs[name] = resolveType(description, typedefs)
+		}
+	}
+	if len(types) > 0 {
+		schema.Types = map[string]*FieldType{}
+		for field, description := range types {
+			schema.Types[field] = resolveType(description, typedefs)
+		}
+	}
+	return schema
+}
+
+// builtinTypes Type kinds that take no arguments
+var builtinTypes = map[string]bool{
+	"int": true, "bool": true, "real": true, "line": true, "date": true,
+	"field": true, "email": true, "uuid": true,
+}
+
+// resolveType Parse a type description, following typedef names to the
+// type they stand for
+func resolveType(description string, typedefs map[string]string) *FieldType {
+	t := &FieldType{Description: description}
+	seen := map[string]bool{}
+	for {
+		kind, args, _ := cutWord(description)
+		if builtinTypes[kind] {
+			t.Kind = kind
+			return t
+		}
+		switch kind {
+		case "range":
+			t.Kind = kind
+			t.Min, t.Max = parseRange(args)
+			return t
+		case "size":
+			t.Kind = kind
+			t.Size, _ = strconv.Atoi(firstWord(args))
+			return t
+		case "regexp":
+			t.Kind = kind
+			t.Regexp = parseRegexp(args)
+			return t
+		case "enum":
+			t.Kind = kind
+			t.Values = parseEnum(args)
+			return t
+		case "rec":
+			t.Kind = kind
+			t.Record = firstWord(args)
+			return t
+		}
+
+		// Any other name refers to a typedef
+		next, ok := typedefs[kind]
+		if !ok || seen[kind] {
+			return t
+		}
+		seen[kind] = true
+		if t.Typedef == "" {
+			t.Typedef = kind
+		}
+		description = next
+	}
+}
+
+// parseRange Parse the bounds of "range MIN MAX" or "range MAX", nil for the
+// MIN and MAX keywords
+func parseRange(args string) (*int64, *int64) {
+	bound := func(s string) *int64 {
+		n, err := parseInteger(s)
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+	parts := strings.Fields(args)
+	switch len(parts) {
+	case 0:
+		return nil, nil
+	case 1:
+		var zero int64
+		return &zero, bound(parts[0])
+	default:
+		return bound(parts[0]), bound(parts[1])
+	}
+}
+
+// parseRegexp Extract the pattern of "regexp /RE/", where the first
+// character is the delimiter
+func parseRegexp(args string) string {
+	if args == "" {
+		return ""
+	}
+	delim := args[:1]
+	pattern := args[1:]
+	if i := strings.LastIndex(pattern, delim); i >= 0 {
+		pattern = pattern[:i]
+	}
+	return pattern
+}
+
+// parseEnum Split the values of "enum A B C", dropping (comments)
+func parseEnum(args string) []string {
+	var values []string
+	depth := 0
+	for _, word := range strings.Fields(args) {
+		if depth == 0 && !strings.HasPrefix(word, "(") {
+			values = append(values, word)
+			continue
+		}
+		depth += strings.Count(word, "(") - strings.Count(word, ")")
+		if depth < 0 {
+			depth = 0
+		}
+	}
+	return values
+}
+
+// parseSize Parse "%size: [OPERATOR] NUMBER"
+func parseSize(value string) *SizeConstraint {
+	operator := "=="
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(value, op) {
+			operator = op
+			value = strings.TrimSpace(value[len(op):])
+			break
+		}
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &SizeConstraint{Operator: operator, Count: count}
+}
+
+// firstWord Return the first whitespace separated word of s
+func firstWord(s string) string {
+	word, _, _ := cutWord(s)
+	return word
+}
+
+// cutWord Split s into its first word and the trimmed rest
+func cutWord(s string) (string, string, bool) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t\n")
+	if i < 0 {
+		return s, "", s != ""
+	}
+	return s[:i], strings.TrimSpace(s[i:]), true
+}
+
+// GetSchema Return the parsed descriptors of the record sets of a database,
+// or of the one of recordType if given
+func (ro *RecordOperation) GetSchema(ctx context.Context, databaseFile, recordType string) (*Result, error) {
+	db, err := ro.ReadDatabase(ctx, databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	var schema []*RecordSetSchema
+	for _, rs := range db.RecordSets {
+		if rs.Descriptor == nil || recordType != "" && rs.Type() != recordType {
+			continue
+		}
+		schema = append(schema, rs.Schema())
+	}
+	if recordType != "" && len(schema) == 0 {
+		return failedResult(fmt.Errorf("record type %s not found", recordType))
+	}
+
+	return &Result{
+		Success: true,
+		Output:  fmt.Sprintf("%d record types", len(schema)),
+		Error:   "",
+		Schema:  schema,
+	}, nil
+}
@@ -0,0 +1,142 @@
+// recutils package: Unit tests for parsed record descriptors
+package recutils
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSchemaDatabase Database with every descriptor field the schema covers
+const testSchemaDatabase = `%rec: Person
+%doc: People we work with
+%key: Id
+%mandatory: Name
+%mandatory: Email
+%allowed: Id Name Email Age Status Team Code Born Score Bio Ref
+%prohibit: Password
+%unique: Email
+%auto: Id
+%sort: Name
+%confidential: Salary
+%size: <= 100
+%constraint: Age > 17
+%typedef: Age_t range 18 MAX
+%typedef: Adult_t Age_t
+%typedef: Status_t enum Active (currently employed) Retired Left
+%type: Id int
+%type: Age Adult_t
+%type: Status Status_t
+%type: Name,Team line
+%type: Code regexp /^[A-Z]{3}$/
+%type: Born date
+%type: Score range 10
+%type: Bio size 200
+%type: Ref rec Project
+%type: Other Missing_t
+
+Id: 1
+Name: John Doe
+
+%rec: Project
+%size: 3
+
+Title: Garden
+`
+
+// TestRecordSetSchema tests parsing a descriptor into a schema
+func TestRecordSetSchema(t *testing.T) {
+	db, err := Parse(strings.NewReader(testSchemaDatabase))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	schema := db.RecordSet("Person").Schema()
+
+	if schema.Type != "Person" || schema.Doc != "People we work with" || schema.Key != "Id" || schema.RecordCount != 1 {
+		t.Errorf("Unexpected schema %+v", schema)
+	}
+	lists := map[string][2][]string{
+		"mandatory":    {schema.Mandatory, {"Name", "Email"}},
+		"prohibit":     {schema.Prohibit, {"Password"}},
+		"unique":       {schema.Unique, {"Email"}},
+		"auto":         {schema.Auto, {"Id"}},
+		"sort":         {schema.Sort, {"Name"}},
+		"confidential": {schema.Confidential, {"Salary"}},
+		"constraints":  {schema.Constraints, {"Age > 17"}},
+	}
+	for name, list := range lists {
+		if !reflect.DeepEqual(list[0], list[1]) {
+			t.Errorf("Expected %s %v, got %v", name, list[1], list[0])
+		}
+	}
+	if len(schema.Allowed) != 11 {
+		t.Errorf("Expected 11 allowed fields, got %v", schema.Allowed)
+	}
+	if schema.Size == nil || *schema.Size != (SizeConstraint{Operator: "<=", Count: 100}) {
+		t.Errorf("Unexpected size %+v", schema.Size)
+	}
+
+	ptr := func(n int64) *int64 { return &n }
+	want := map[string]*FieldType{
+		"Id":     {Kind: "int", Description: "int"},
+		"Age":    {Kind: "range", Typedef: "Adult_t", Min: ptr(18), Description: "Adult_t"},
+		"Status": {Kind: "enum", Typedef: "Status_t", Values: []string{"Active", "Retired", "Left"}, Description: "Status_t"},
+		"Name":   {Kind: "line", Description: "line"},
+		"Team":   {Kind: "line", Description: "line"},
+		"Code":   {Kind: "regexp", Regexp: "^[A-Z]{3}$", Description: "regexp /^[A-Z]{3}$/"},
+		"Born":   {Kind: "date", Description: "date"},
+		"Score":  {Kind: "range", Min: ptr(0), Max: ptr(10), Description: "range 10"},
+		"Bio":    {Kind: "size", Size: 200, Description: "size 200"},
+		"Ref":    {Kind: "rec", Record: "Project", Description: "rec Project"},
+		"Other":  {Kind: "", Description: "Missing_t"},
+	}
+	if !reflect.DeepEqual(schema.Types, want) {
+		got, _ := json.MarshalIndent(schema.Types, "", "  ")
+		t.Errorf("Unexpected types %s", got)
+	}
+	if len(schema.Typedefs) != 3 || schema.Typedefs["Adult_t"].Typedef != "Age_t" || schema.Typedefs["Age_t"].Kind != "range" {
+		t.Errorf("Unexpected typedefs %+v", schema.Typedefs)
+	}
+
+	project := db.RecordSet("Project").Schema()
+	if project.Size == nil || *project.Size != (SizeConstraint{Operator: "==", Count: 3}) {
+		t.Errorf("Unexpected size %+v", project.Size)
+	}
+	if project.Types != nil || project.Key != "" {
+		t.Errorf("Unexpected Project schema %+v", project)
+	}
+}
+
+// TestResolveTypeCycle tests that typedef cycles terminate
+func TestResolveTypeCycle(t *testing.T) {
+	typedefs := map[string]string{"A_t": "B_t", "B_t": "A_t"}
+	if ft := resolveType("A_t", typedefs); ft.Kind != "" || ft.Typedef != "A_t" {
+		t.Errorf("Unexpected type %+v", ft)
+	}
+}
+
+// TestGetSchema tests the schema of a database file
+func TestGetSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	if err := os.WriteFile(path, []byte(testSchemaDatabase), 0644); err != nil {
+		t.Fatal(err)
+	}
+	op := NewRecordOperation()
+	ctx := context.Background()
+
+	result, err := op.GetSchema(ctx, path, "")
+	if err != nil || !result.Success || len(result.Schema) != 2 {
+		t.Fatalf("Unexpected result %+v, %v", result, err)
+	}
+	result, err = op.GetSchema(ctx, path, "Project")
+	if err != nil || len(result.Schema) != 1 || result.Schema[0].Type != "Project" {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+	if result, err := op.GetSchema(ctx, path, "Task"); err == nil || result.Success {
+		t.Errorf("Expected missing record type to fail, got %+v", result)
+	}
+}
@@ -0,0 +1,37 @@
+// recutils package: Time limits for recutils commands
+package recutils
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultCommandTimeout Time a single recutils command may run unless
+// configured with WithCommandTimeout
+const DefaultCommandTimeout = 30 * time.Second
+
+// WithCommandTimeout Set how long a single recutils command may run before
+// it is killed. Zero or negative disables the limit.
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(ro *RecordOperation) {
+		ro.defaultCommandTimeout = timeout
+	}
+}
+
+// commandTimeoutKey Context key of a command timeout override
+type commandTimeoutKey struct{}
+
+// ContextWithCommandTimeout Override the command timeout for operations run
+// with the returned context, e.g. for a single tool. Zero or negative
+// disables the limit.
+func ContextWithCommandTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, commandTimeoutKey{}, timeout)
+}
+
+// commandTimeout Command timeout that applies to ctx
+func (ro *RecordOperation) commandTimeout(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(commandTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return ro.defaultCommandTimeout
+}
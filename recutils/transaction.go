@@ -0,0 +1,307 @@
+// recutils package: Multi-operation transactions on a single database
+package recutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrTxDone Transaction was already committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// ErrTxFailed A step or the commit check of the transaction failed, so it
+// can only be rolled back
+var ErrTxFailed = errors.New("transaction has failed and can only be rolled back")
+
+// Tx Transaction on a single database. The database stays exclusively locked
+// from Begin until Commit or Rollback. Steps are applied to a private working
+// copy, which Commit checks with recfix and atomically swaps in, and Rollback
+// discards. A Tx must not be used concurrently.
+type Tx struct {
+	ro           *RecordOperation
+	ctx          context.Context // from Begin, used by the check of Commit
+	databaseFile string
+	workingCopy  string
+	before       []byte // database content at Begin
+	unlock       func()
+	created      bool // the database did not exist before Begin
+	failed       bool
+	done         bool
+}
+
+// Begin Start a transaction on databaseFile. ctx applies to the whole
+// transaction, including the integrity check of Commit.
+func (ro *RecordOperation) Begin(ctx context.Context, databaseFile string) (*Tx, error) {
+	if ro.readOnly {
+		return nil, &PermissionError{Operation: "Begin"}
+	}
+
+	databaseFile, err := ro.resolvePath(databaseFile)
+	if err != nil {
+		return nil, err
+	}
+
+	_, statErr := os.Stat(databaseFile)
+	unlock, err := ro.lockDatabase(ctx, databaseFile, lockExclusive, true)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Tx{
+		ro:           ro,
+		ctx:          ctx,
+		databaseFile: databaseFile,
+		unlock:       unlock,
+		created:      errors.Is(statErr, os.ErrNotExist),
+	}
+	if err := tx.copyDatabase(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// copyDatabase Create the working copy next to the database
+func (tx *Tx) copyDatabase() error {
+	content, err := os.ReadFile(tx.databaseFile)
+	if err != nil {
+		return fmt.Errorf("failed to read database file: %w", err)
+	}
+	tx.before = content
+	tx.workingCopy, err = createWorkingCopy(tx.databaseFile, content, "tx")
+	return err
+}
+
+// createWorkingCopy Write content to the hidden file next to the database
+// named after it and kind, e.g. .people.rec.check, and return its path. The
+// name does not change between runs, so recorded commands on the working
+// copy can be replayed. The database is exclusively locked while the copy
+// exists, so a copy left behind by a crashed process is replaced.
+func createWorkingCopy(databaseFile string, content []byte, kind string) (string, error) {
+	dir, base := filepath.Split(databaseFile)
+	path := filepath.Join(dir, "."+base+"."+kind)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to remove stale working copy: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create working copy: %w", err)
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write working copy: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write working copy: %w", err)
+	}
+	return path, nil
+}
+
+// Insert Insert a record within the transaction
+func (tx *Tx) Insert(ctx context.Context, recordType string, fields map[string]interface{}) (*Result, error) {
+	return tx.step(func() (*Result, error) {
+		return tx.ro.insertRecord(ctx, tx.workingCopy, recordType, fieldValues(fields), true)
+	})
+}
+
+// Update Update records within the transaction
+func (tx *Tx) Update(ctx context.Context, recordType, queryExpression string, fields map[string]interface{}) (*Result, error) {
+	return tx.step(func() (*Result, error) {
+		return tx.ro.updateRecords(ctx, tx.workingCopy, recordType, queryExpression, fields)
+	})
+}
+
+// Delete Delete records within the transaction
+func (tx *Tx) Delete(ctx context.Context, recordType, queryExpression string) (*Result, error) {
+	return tx.step(func() (*Result, error) {
+		return tx.ro.deleteRecords(ctx, tx.workingCopy, recordType, queryExpression)
+	})
+}
+
+// step Apply one step to the working copy. Once a step failed no further
+// steps are applied.
+func (tx *Tx) step(apply func() (*Result, error)) (*Result, error) {
+	if tx.done {
+		return failedResult(ErrTxDone)
+	}
+	if tx.failed {
+		return failedResult(ErrTxFailed)
+	}
+
+	result, err := apply()
+	if err != nil || result == nil || !result.Success {
+		tx.failed = true
+	}
+	return result, err
+}
+
+// Commit Check the working copy with recfix, atomically replace the database
+// with it and end the transaction. A transaction with a failed step, or whose
+// changes introduce integrity errors (reported as an *IntegrityError), is not
+// committed and stays open for Rollback.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if tx.failed {
+		return ErrTxFailed
+	}
+
+	content, err := os.ReadFile(tx.workingCopy)
+	if err != nil {
+		tx.failed = true
+		return fmt.Errorf("failed to read working copy: %w", err)
+	}
+	if !bytes.Equal(tx.before, content) {
+		introduced, err := tx.ro.newDiagnostics(tx.ctx, tx.databaseFile, string(tx.before), string(content))
+		if err != nil {
+			tx.failed = true
+			return fmt.Errorf("integrity check failed: %w", err)
+		}
+		if len(introduced) > 0 {
+			tx.failed = true
+			return &IntegrityError{Diagnostics: introduced}
+		}
+	}
+
+	defer tx.finish()
+	if err := writeFileAtomic(tx.databaseFile, content, 0644); err != nil {
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	return nil
+}
+
+// Rollback Discard the working copy and end the transaction, leaving the
+// database as it was before Begin
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+
+	// Begin created an empty file to lock, remove it again
+	if tx.created {
+		if info, err := os.Stat(tx.databaseFile); err == nil && info.Size() == 0 {
+			os.Remove(tx.databaseFile)
+		}
+	}
+	return nil
+}
+
+// finish Remove the working copy and release the lock
+func (tx *Tx) finish() {
+	tx.done = true
+	if tx.workingCopy != "" {
+		os.Remove(tx.workingCopy)
+	}
+	tx.unlock()
+}
+
+// TxStep Single step of a transaction run with RunTransaction
+type TxStep struct {
+	Operation       string                 `json:"operation"`                  // insert, update or delete
+	RecordType      string                 `json:"record_type,omitempty"`      // record type the step applies to
+	QueryExpression string                 `json:"query_expression,omitempty"` // selects records to update or delete
+	Fields          map[string]interface{} `json:"fields,omitempty"`           // fields to insert or set
+}
+
+// StepResult Outcome of a single transaction step
+type StepResult struct {
+	Success  bool   `json:"success"`
+	Output   string `json:"output"`
+	Error    string `json:"error"`
+	Affected int    `json:"affected,omitempty"`
+}
+
+// RunTransaction Apply steps as a single transaction. The database is only
+// changed if every step succeeds; the result of each applied step is
+// reported in Steps.
+func (ro *RecordOperation) RunTransaction(ctx context.Context, databaseFile string, steps []TxStep) (*Result, error) {
+	if len(steps) == 0 {
+		return &Result{Success: false, Output: "", Error: "at least one step is required"}, nil
+	}
+
+	tx, err := ro.Begin(ctx, databaseFile)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	results := make([]StepResult, 0, len(steps))
+	affected := 0
+	for i, step := range steps {
+		var result *Result
+		switch step.Operation {
+		case "insert":
+			result, err = tx.Insert(ctx, step.RecordType, step.Fields)
+		case "update":
+			result, err = tx.Update(ctx, step.RecordType, step.QueryExpression, step.Fields)
+		case "delete":
+			result, err = tx.Delete(ctx, step.RecordType, step.QueryExpression)
+		default:
+			result = &Result{Success: false, Output: "", Error: fmt.Sprintf("unknown operation %q", step.Operation)}
+		}
+		if result == nil {
+			result = &Result{Success: false, Output: "", Error: err.Error()}
+		}
+		results = append(results, StepResult{
+			Success:  result.Success,
+			Output:   result.Output,
+			Error:    result.Error,
+			Affected: result.Affected,
+		})
+
+		if err != nil || !result.Success {
+			tx.Rollback()
+			message := result.Error
+			if err != nil {
+				message = err.Error()
+			}
+			return &Result{
+				Success: false,
+				Output:  "",
+				Error:   fmt.Sprintf("step %d (%s) failed, transaction rolled back: %s", i+1, step.Operation, message),
+				Steps:   results,
+			}, nil
+		}
+		if step.Operation == "insert" {
+			affected++
+		} else {
+			affected += result.Affected
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		var integrityErr *IntegrityError
+		if errors.As(err, &integrityErr) {
+			return &Result{
+				Success:     false,
+				Output:      "",
+				Error:       "transaction rolled back: " + err.Error(),
+				Steps:       results,
+				Diagnostics: integrityErr.Diagnostics,
+			}, nil
+		}
+		return &Result{
+			Success: false,
+			Output:  "",
+			Error:   err.Error(),
+			Steps:   results,
+		}, err
+	}
+
+	return &Result{
+		Success:  true,
+		Output:   fmt.Sprintf("Transaction committed, %d steps applied", len(steps)),
+		Error:    "",
+		Affected: affected,
+		Steps:    results,
+	}, nil
+}
@@ -0,0 +1,276 @@
+// recutils package: Unit tests for transactions
+package recutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// passRecfix Runner accepting every recfix check and running nothing else
+var passRecfix = WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+	if argv[0] != "recfix" {
+		return RunOutput{}, &exec.Error{Name: argv[0], Err: exec.ErrNotFound}
+	}
+	return RunOutput{}, nil
+}))
+
+// TestTransactionLifecycle tests Begin, Commit and Rollback without recutils
+func TestTransactionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	op := NewRecordOperation(passRecfix)
+
+	t.Run("Commit insert into new database", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "new.rec")
+
+		tx, err := op.Begin(ctx, path)
+		if err != nil {
+			t.Fatalf("Begin failed: %v", err)
+		}
+		result, err := tx.Insert(ctx, "Invoice", map[string]interface{}{"Id": 1})
+		if err != nil || !result.Success {
+			t.Fatalf("Insert failed: %v, %+v", err, result)
+		}
+		if content, _ := os.ReadFile(path); len(content) != 0 {
+			t.Errorf("Database changed before commit: %q", content)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		if content, _ := os.ReadFile(path); string(content) != "%rec: Invoice\n\nId: 1\n" {
+			t.Errorf("Unexpected content %q", content)
+		}
+		assertNoTempFiles(t, dir)
+
+		if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+			t.Errorf("Expected ErrTxDone, got %v", err)
+		}
+		if err := tx.Rollback(); !errors.Is(err, ErrTxDone) {
+			t.Errorf("Expected ErrTxDone, got %v", err)
+		}
+		if result, err := tx.Insert(ctx, "Invoice", nil); !errors.Is(err, ErrTxDone) || result.Success {
+			t.Errorf("Expected ErrTxDone, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("Rollback restores missing database", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "new.rec")
+
+		tx, err := op.Begin(ctx, path)
+		if err != nil {
+			t.Fatalf("Begin failed: %v", err)
+		}
+		tx.Insert(ctx, "Invoice", map[string]interface{}{"Id": 1})
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("Database should not exist after rollback")
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("Rollback keeps existing database", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "db.rec")
+		if err := os.WriteFile(path, []byte(""), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := op.Begin(ctx, path)
+		if err != nil {
+			t.Fatalf("Begin failed: %v", err)
+		}
+		tx.Insert(ctx, "Invoice", map[string]interface{}{"Id": 1})
+		tx.Rollback()
+
+		if content, err := os.ReadFile(path); err != nil || len(content) != 0 {
+			t.Errorf("Database changed by rollback: %q, %v", content, err)
+		}
+		assertNoTempFiles(t, dir)
+	})
+
+	t.Run("Database is locked until the end", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db.rec")
+		tx, err := op.Begin(ctx, path)
+		if err != nil {
+			t.Fatalf("Begin failed: %v", err)
+		}
+
+		other := NewRecordOperation(WithLockTimeout(0), passRecfix)
+		if _, err := other.InsertRecord(ctx, path, "Invoice", map[string]interface{}{"Id": 2}); !errors.Is(err, ErrDatabaseBusy) {
+			t.Errorf("Expected ErrDatabaseBusy during transaction, got %v", err)
+		}
+		if _, err := other.Begin(ctx, path); !errors.Is(err, ErrDatabaseBusy) {
+			t.Errorf("Expected ErrDatabaseBusy for second transaction, got %v", err)
+		}
+
+		tx.Rollback()
+		other = NewRecordOperation(WithLockTimeout(time.Second), passRecfix)
+		if result, err := other.InsertRecord(ctx, path, "Invoice", map[string]interface{}{"Id": 2}); err != nil || !result.Success {
+			t.Errorf("Expected insert after rollback, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("Read-only", func(t *testing.T) {
+		_, err := NewRecordOperation(WithReadOnly()).Begin(ctx, filepath.Join(t.TempDir(), "db.rec"))
+		var perr *PermissionError
+		if !errors.As(err, &perr) {
+			t.Errorf("Expected PermissionError, got %v", err)
+		}
+	})
+
+	t.Run("Outside root", func(t *testing.T) {
+		_, err := NewRecordOperation(WithRoots(t.TempDir())).Begin(ctx, "../db.rec")
+		if !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Expected ErrOutsideRoot, got %v", err)
+		}
+	})
+}
+
+// TestTransactionIntegrity tests that Commit refuses changes introducing
+// integrity errors and leaves the transaction open for Rollback
+func TestTransactionIntegrity(t *testing.T) {
+	ctx := context.Background()
+	op := NewRecordOperation(WithRunner(fakeIntegrity(t)))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "people.rec")
+
+	tx, err := op.Begin(ctx, path)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if result, err := tx.Insert(ctx, "Person", map[string]interface{}{"Id": 2}); err != nil || !result.Success {
+		t.Fatalf("Insert failed: %+v, %v", result, err)
+	}
+	var integrityErr *IntegrityError
+	if err := tx.Commit(); !errors.As(err, &integrityErr) || len(integrityErr.Diagnostics) != 1 {
+		t.Fatalf("Expected an IntegrityError, got %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Expected the transaction to stay open for Rollback, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Database should not exist after rollback")
+	}
+
+	result, err := op.RunTransaction(ctx, path, []TxStep{
+		{Operation: "insert", RecordType: "Person", Fields: map[string]interface{}{"Id": 2}},
+	})
+	if err != nil || result.Success || len(result.Diagnostics) != 1 || !strings.Contains(result.Error, "rolled back") {
+		t.Errorf("Expected a rolled back transaction, got %+v, %v", result, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Database should not exist after rollback")
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// TestRunTransactionValidation tests transactions that fail before running recutils
+func TestRunTransactionValidation(t *testing.T) {
+	ctx := context.Background()
+	op := NewRecordOperation()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.rec")
+
+	result, err := op.RunTransaction(ctx, path, nil)
+	if err != nil || result.Success {
+		t.Errorf("Expected failed result for no steps, got %+v, %v", result, err)
+	}
+
+	result, err = op.RunTransaction(ctx, path, []TxStep{
+		{Operation: "insert", RecordType: "Invoice", Fields: map[string]interface{}{"Id": 1}},
+		{Operation: "upsert", RecordType: "Invoice"},
+	})
+	if err != nil || result.Success {
+		t.Fatalf("Expected failed result, got %+v, %v", result, err)
+	}
+	if len(result.Steps) != 2 || !result.Steps[0].Success || result.Steps[1].Success {
+		t.Errorf("Unexpected step results %+v", result.Steps)
+	}
+	if !strings.Contains(result.Error, "step 2") {
+		t.Errorf("Error should name the failed step: %q", result.Error)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Database should not exist after failed transaction")
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// TestRunTransaction tests transactions against a real database
+func TestRunTransaction(t *testing.T) {
+	for _, tool := range []string{"recsel", "recins", "recfix"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip("recutils not installed, skipping test")
+		}
+	}
+
+	ctx := context.Background()
+	op := NewRecordOperation()
+	testData := `%rec: Customer
+
+Id: 1
+Balance: 100
+
+%rec: Invoice
+
+Id: 1
+Status: draft
+`
+
+	setup := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "test_transaction.rec")
+		if err := os.WriteFile(path, []byte(testData), 0644); err != nil {
+			t.Fatalf("Failed to create test database: %v", err)
+		}
+		return path
+	}
+
+	t.Run("All steps succeed", func(t *testing.T) {
+		path := setup(t)
+
+		result, err := op.RunTransaction(ctx, path, []TxStep{
+			{Operation: "insert", RecordType: "Invoice", Fields: map[string]interface{}{"Id": 2, "Status": "final"}},
+			{Operation: "update", RecordType: "Customer", QueryExpression: "Id = 1", Fields: map[string]interface{}{"Balance": 150}},
+			{Operation: "delete", RecordType: "Invoice", QueryExpression: "Status = 'draft'"},
+		})
+		if err != nil || !result.Success {
+			t.Fatalf("Transaction failed: %v, %+v", err, result)
+		}
+		if len(result.Steps) != 3 || result.Affected != 3 {
+			t.Errorf("Unexpected step results %+v, affected %d", result.Steps, result.Affected)
+		}
+
+		content, _ := os.ReadFile(path)
+		if !strings.Contains(string(content), "Balance: 150") ||
+			!strings.Contains(string(content), "Status: final") ||
+			strings.Contains(string(content), "draft") {
+			t.Errorf("Unexpected database content: %s", content)
+		}
+	})
+
+	t.Run("Failed step rolls back", func(t *testing.T) {
+		path := setup(t)
+
+		result, err := op.RunTransaction(ctx, path, []TxStep{
+			{Operation: "update", RecordType: "Customer", QueryExpression: "Id = 1", Fields: map[string]interface{}{"Balance": 150}},
+			{Operation: "delete", RecordType: "Invoice", QueryExpression: "Status = "},
+		})
+		if err != nil || result.Success {
+			t.Fatalf("Expected failed transaction, got %+v, %v", result, err)
+		}
+
+		if content, _ := os.ReadFile(path); string(content) != testData {
+			t.Errorf("Database changed by failed transaction: %s", content)
+		}
+	})
+}
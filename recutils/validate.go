@@ -0,0 +1,219 @@
+// recutils package: Validation of field values against %type
+package recutils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError Field rejected for its name or for the type of its value
+type FieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Message string `json:"message"` // what the type expects, e.g. "expected an integer"
+}
+
+// ValidationError Fields with invalid names or values not matching their
+// declared types
+type ValidationError struct {
+	RecordType string
+	Errors     []FieldError
+}
+
+// Error Implement the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return fmt.Sprintf("invalid fields for %s: %s", e.RecordType, strings.Join(messages, "; "))
+}
+
+var (
+	intPattern   = regexp.MustCompile(`^-?(0x[0-9a-fA-F]+|[0-9]+)$`)
+	realPattern  = regexp.MustCompile(`^-?([0-9]+|[0-9]*\.[0-9]+)$`)
+	emailPattern = regexp.MustCompile(`^[a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// boolValues Values accepted by the bool type
+var boolValues = map[string]bool{"yes": true, "no": true, "true": true, "false": true, "1": true, "0": true}
+
+// parseInteger Parse an integer as the int type writes it: decimal, or
+// hexadecimal with a 0x prefix. Unlike strconv.ParseInt with base 0, a
+// leading zero does not make it octal and underscores are not allowed.
+func parseInteger(value string) (int64, error) {
+	if !intPattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid integer %q", value)
+	}
+	digits, negative := strings.CutPrefix(value, "-")
+	base := 10
+	if hex, ok := strings.CutPrefix(digits, "0x"); ok {
+		digits, base = hex, 16
+	}
+	if negative {
+		digits = "-" + digits
+	}
+	return strconv.ParseInt(digits, base, 64)
+}
+
+// dateLayouts Date formats checked by the date type. recutils accepts
+// more, these are the unambiguous common ones.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006/01/02",
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC822,
+	time.RFC822Z,
+	time.ANSIC,
+	time.UnixDate,
+}
+
+// Validate Check a value against the type. Types that cannot be checked
+// without the rest of the database, such as rec, accept every value.
+func (t *FieldType) Validate(value string) error {
+	value = strings.TrimSpace(value)
+	switch t.Kind {
+	case "int":
+		if !intPattern.MatchString(value) {
+			return fmt.Errorf("expected an integer")
+		}
+	case "real":
+		if !realPattern.MatchString(value) {
+			return fmt.Errorf("expected a real number")
+		}
+	case "bool":
+		if !boolValues[value] {
+			return fmt.Errorf("expected yes, no, true, false, 1 or 0")
+		}
+	case "range":
+		n, err := parseInteger(value)
+		if err != nil || t.Min != nil && n < *t.Min || t.Max != nil && n > *t.Max {
+			return fmt.Errorf("expected an integer in %s", t.rangeText())
+		}
+	case "enum":
+		for _, v := range t.Values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s", strings.Join(t.Values, ", "))
+	case "regexp":
+		// Patterns Go cannot compile are left to recutils
+		if re, err := regexp.Compile(t.Regexp); err == nil && !re.MatchString(value) {
+			return fmt.Errorf("expected a value matching /%s/", t.Regexp)
+		}
+	case "date":
+		// recutils understands many more dates than the layouts, such as
+		// "yesterday", so only dates of a known layout with a month, day or
+		// time out of range are rejected here and the rest left to recfix
+		for _, layout := range dateLayouts {
+			_, err := time.Parse(layout, value)
+			if err == nil {
+				return nil
+			}
+			var parseErr *time.ParseError
+			if errors.As(err, &parseErr) && strings.HasSuffix(parseErr.Message, "out of range") {
+				return fmt.Errorf("expected a date such as 2006-01-02 or 2006-01-02T15:04:05Z")
+			}
+		}
+	case "email":
+		if !emailPattern.MatchString(value) {
+			return fmt.Errorf("expected an email address")
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(value) {
+			return fmt.Errorf("expected a UUID")
+		}
+	case "size":
+		if len(value) > t.Size {
+			return fmt.Errorf("expected at most %d characters, got %d", t.Size, len(value))
+		}
+	case "line":
+		if strings.Contains(value, "\n") {
+			return fmt.Errorf("expected a single line")
+		}
+	case "field":
+		if !IsValidFieldName(value) {
+			return fmt.Errorf("expected a field name")
+		}
+	}
+	return nil
+}
+
+// rangeText Describe the bounds of a range type, e.g. "[0, 120]"
+func (t *FieldType) rangeText() string {
+	bound := func(n *int64, keyword string) string {
+		if n == nil {
+			return keyword
+		}
+		return strconv.FormatInt(*n, 10)
+	}
+	return fmt.Sprintf("[%s, %s]", bound(t.Min, "MIN"), bound(t.Max, "MAX"))
+}
+
+// Validate Check field values against the declared types of the record set.
+// Fields without a type are not checked. It returns a *ValidationError
+// listing every rejected field, in the order of fields.
+func (s *RecordSetSchema) Validate(fields []FieldValue) error {
+	var errs []FieldError
+	for _, field := range fields {
+		t, ok := s.Types[field.Name]
+		if !ok {
+			continue
+		}
+		if err := t.Validate(field.text()); err != nil {
+			errs = append(errs, FieldError{Field: field.Name, Value: field.text(), Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{RecordType: s.Type, Errors: errs}
+	}
+	return nil
+}
+
+// fieldNameError Describe what is wrong with the name of a field of a
+// regular record, or return "" if it is valid
+func fieldNameError(name string) string {
+	switch {
+	case strings.HasPrefix(name, "%"):
+		return "special fields belong in the record descriptor"
+	case !IsValidFieldName(name):
+		return "invalid field name, expected a letter followed by letters, digits or underscores"
+	}
+	return ""
+}
+
+// validateFields Check the names of fields, and their values against the
+// types of rs if it has a descriptor. It returns a failed result listing the
+// rejected fields, or nil if every field is valid.
+func validateFields(recordType string, rs *RecordSet, fields []FieldValue) (*Result, error) {
+	var errs []FieldError
+	for _, field := range fields {
+		if message := fieldNameError(field.Name); message != "" {
+			errs = append(errs, FieldError{Field: field.Name, Value: field.text(), Message: message})
+		}
+	}
+	if len(errs) == 0 && rs != nil && rs.Descriptor != nil {
+		var verr *ValidationError
+		if errors.As(rs.Schema().Validate(fields), &verr) {
+			errs = verr.Errors
+		}
+	}
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	result, err := failedResult(&ValidationError{RecordType: recordType, Errors: errs})
+	result.FieldErrors = errs
+	return result, err
+}
@@ -0,0 +1,232 @@
+// recutils package: Unit tests for field validation against %type
+package recutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFieldTypeValidate tests the values accepted by each type
+func TestFieldTypeValidate(t *testing.T) {
+	db, err := Parse(strings.NewReader(testSchemaDatabase + `
+%rec: Types
+%type: I int
+%type: R real
+%type: B bool
+%type: E email
+%type: U uuid
+%type: L line
+%type: F field
+%type: S size 3
+%type: D date
+%type: Neg range -5 -1
+%type: Small range 0 20
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	types := db.RecordSet("Types").Schema().Types
+	person := db.RecordSet("Person").Schema().Types
+
+	tests := []struct {
+		t       *FieldType
+		valid   []string
+		invalid []string
+	}{
+		{types["I"], []string{"0", "-12", "0x1F", " 7 "}, []string{"abc", "1.5", "", "1e3"}},
+		{types["R"], []string{"1", "-1.5", ".5"}, []string{"1.", "abc", "1,5"}},
+		{types["B"], []string{"yes", "no", "true", "false", "1", "0"}, []string{"Yes", "maybe", "2"}},
+		{types["E"], []string{"john@example.com", "a.b+c@mail.example.org"}, []string{"john", "john@", "@example.com", "john@example"}},
+		{types["U"], []string{"123e4567-e89b-12d3-a456-426614174000"}, []string{"123e4567e89b12d3a456426614174000", "xyz"}},
+		{types["L"], []string{"one line"}, []string{"two\nlines"}},
+		{types["F"], []string{"Name"}, []string{"no spaces", "1st"}},
+		{types["S"], []string{"abc"}, []string{"abcd"}},
+		{types["D"], []string{"2024-02-29", "2024-02-29T10:00:00Z", "2024-02-29 10:00:00", "yesterday", "29 Feb 2024"}, []string{"2024-13-01", "2023-02-29", "2024-02-29 25:00"}},
+		{types["Neg"], []string{"-5", "-1", "-0x5"}, []string{"0", "-6", "x"}},
+		{types["Small"], []string{"010", "0x14", "20"}, []string{"021", "1_0", "0b101", "0o7", "+5", "0x15"}},
+		{person["Age"], []string{"18", "99"}, []string{"17", "abc"}},
+		{person["Score"], []string{"0", "10"}, []string{"11", "-1"}},
+		{person["Status"], []string{"Active", "Left"}, []string{"active", "(currently", "Gone"}},
+		{person["Code"], []string{"ABC"}, []string{"AB", "abc"}},
+		{person["Bio"], []string{strings.Repeat("x", 200)}, []string{strings.Repeat("x", 201)}},
+		{person["Ref"], []string{"anything"}, nil},
+		{person["Other"], []string{"anything"}, nil},
+	}
+
+	for _, tt := range tests {
+		for _, value := range tt.valid {
+			if err := tt.t.Validate(value); err != nil {
+				t.Errorf("%s: expected %q to be valid, got %v", tt.t.Description, value, err)
+			}
+		}
+		for _, value := range tt.invalid {
+			if err := tt.t.Validate(value); err == nil {
+				t.Errorf("%s: expected %q to be invalid", tt.t.Description, value)
+			}
+		}
+	}
+}
+
+// TestSchemaValidate tests collecting the errors of several fields
+func TestSchemaValidate(t *testing.T) {
+	db, err := Parse(strings.NewReader(testSchemaDatabase))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	err = db.RecordSet("Person").Schema().Validate([]FieldValue{
+		{Name: "Age", Value: 12},
+		{Name: "Id", Value: "abc"},
+		{Name: "Name", Value: "John Doe"},
+		{Name: "Status", Value: "Active"},
+		{Name: "Notes", Value: "untyped"},
+	})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+	want := []FieldError{
+		{Field: "Age", Value: "12", Message: "expected an integer in [18, MAX]"},
+		{Field: "Id", Value: "abc", Message: "expected an integer"},
+	}
+	if !reflect.DeepEqual(verr.Errors, want) {
+		t.Errorf("Expected %+v, got %+v", want, verr.Errors)
+	}
+}
+
+// TestMutationsValidateFields tests that invalid values are rejected before
+// any command runs or the file changes
+func TestMutationsValidateFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	const content = "%rec: Person\n%type: Age int\n\nName: John Doe\nAge: 30\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		commands = append(commands, argv[0])
+		if argv[0] == "recsel" {
+			return RunOutput{Stdout: "Name: John Doe\nAge: 30\n"}, nil
+		}
+		return RunOutput{}, nil
+	})))
+	ctx := context.Background()
+
+	result, err := op.InsertRecord(ctx, path, "Person", map[string]interface{}{"Name": "Jane", "Age": "abc"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || result.Success || len(result.FieldErrors) != 1 || result.FieldErrors[0].Field != "Age" {
+		t.Errorf("Expected insert to be rejected, got %+v, %v", result, err)
+	}
+	if len(commands) != 0 {
+		t.Errorf("Expected no commands, got %v", commands)
+	}
+
+	result, err = op.UpdateRecords(ctx, path, "Person", "Name = 'John Doe'", map[string]interface{}{"Age": "thirty"})
+	if !errors.As(err, &verr) || result.Success || len(result.FieldErrors) != 1 {
+		t.Errorf("Expected update to be rejected, got %+v, %v", result, err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != content {
+		t.Errorf("Database changed:\n%s", after)
+	}
+
+	result, err = op.UpdateRecords(ctx, path, "Person", "Name = 'John Doe'", map[string]interface{}{"Age": 31})
+	if err != nil || !result.Success {
+		t.Errorf("Expected a valid update to succeed, got %+v, %v", result, err)
+	}
+
+	// JSON numbers arrive as float64
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = op.UpdateRecords(ctx, path, "Person", "Name = 'John Doe'", map[string]interface{}{"Age": float64(2000000)})
+	if err != nil || !result.Success {
+		t.Errorf("Expected a large integer to be accepted, got %+v, %v", result, err)
+	}
+	if after, _ := os.ReadFile(path); !strings.Contains(string(after), "Age: 2000000\n") {
+		t.Errorf("Expected the integer in decimal notation:\n%s", after)
+	}
+}
+
+// TestFormatValue tests the text written for JSON values
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"text", "text"},
+		{float64(2000000), "2000000"},
+		{float64(1e21), "1000000000000000000000"},
+		{float64(-0.5), "-0.5"},
+		{float32(1.25), "1.25"},
+		{30, "30"},
+		{true, "true"},
+		{json.Number("12345678901234567890"), "12345678901234567890"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%#v): expected %q, got %q", tt.value, tt.want, got)
+		}
+	}
+}
+
+// TestMutationsRejectFieldNames tests that fields recutils cannot store are
+// rejected, with or without a record descriptor
+func TestMutationsRejectFieldNames(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "people.rec")
+	if err := os.WriteFile(existing, []byte("Name: John Doe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		commands = append(commands, argv[0])
+		if argv[0] == "recsel" {
+			return RunOutput{Stdout: "Name: John Doe\n"}, nil
+		}
+		return RunOutput{}, nil
+	})))
+	ctx := context.Background()
+	created := filepath.Join(dir, "new.rec")
+
+	result, err := op.InsertRecordFields(ctx, created, "Person", []FieldValue{
+		{Name: "Name", Value: "Jane"},
+		{Name: "First Name", Value: "Jane"},
+		{Name: "%rec", Value: "Other"},
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || result.Success {
+		t.Fatalf("Expected insert to be rejected, got %+v, %v", result, err)
+	}
+	var fields []string
+	for _, fe := range result.FieldErrors {
+		fields = append(fields, fe.Field)
+	}
+	if want := []string{"First Name", "%rec"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("Expected errors for %v, got %+v", want, result.FieldErrors)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to be created", created)
+	}
+
+	if _, err := op.InsertRecord(ctx, created, "Bad Type", map[string]interface{}{"Name": "Jane"}); err == nil {
+		t.Error("Expected an invalid record type to be rejected")
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to be created", created)
+	}
+
+	result, err = op.UpdateRecords(ctx, existing, "", "Name = 'John Doe'", map[string]interface{}{"Name:": "x"})
+	if !errors.As(err, &verr) || result.Success || len(result.FieldErrors) != 1 {
+		t.Errorf("Expected update to be rejected, got %+v, %v", result, err)
+	}
+	if len(commands) != 1 || commands[0] != "recsel" {
+		t.Errorf("Expected only the selecting recsel, got %v", commands)
+	}
+}
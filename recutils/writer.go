@@ -0,0 +1,166 @@
+// recutils package: Native writer for the rec file format
+package recutils
+
+import (
+	"io"
+	"strings"
+)
+
+// WriteTo Write the database in rec format. Records and fields that were not
+// modified since parsing are written back byte-for-byte.
+func (db *Database) WriteTo(w io.Writer) (int64, error) {
+	rw := &recWriter{w: w}
+
+	rw.writeString(db.head)
+	for _, rs := range db.RecordSets {
+		if rs.Descriptor != nil {
+			rw.writeRecord(rs.Descriptor)
+		}
+		for _, r := range rs.Records {
+			rw.writeRecord(r)
+		}
+	}
+	if db.trailer != "" {
+		rw.ensureNewline()
+		rw.writeString(db.trailer)
+	}
+
+	return rw.n, rw.err
+}
+
+// String Return the database in rec format
+func (db *Database) String() string {
+	var sb strings.Builder
+	db.WriteTo(&sb)
+	return sb.String()
+}
+
+// String Return the record in rec format, without surrounding blank lines
+func (r *Record) String() string {
+	var sb strings.Builder
+	rw := &recWriter{w: &sb}
+	for _, f := range r.Fields {
+		rw.ensureNewline()
+		rw.writeField(f)
+	}
+	if r.tail != "" {
+		rw.ensureNewline()
+		rw.writeString(r.tail)
+	}
+	return sb.String()
+}
+
+// recWriter Writer keeping track of the lines written so that records are
+// always separated correctly. Like the parser, it takes lines holding only
+// whitespace, such as " " or the "\r" of CRLF files, as blank.
+type recWriter struct {
+	w         io.Writer
+	n         int64
+	last      byte // last byte written
+	lineText  bool // the current line has text other than whitespace
+	prevBlank bool // the last complete line was blank
+	err       error
+}
+
+func (rw *recWriter) writeString(s string) {
+	if rw.err != nil || s == "" {
+		return
+	}
+	n, err := io.WriteString(rw.w, s)
+	rw.n += int64(n)
+	rw.err = err
+	rw.last = s[len(s)-1]
+
+	for {
+		i := strings.IndexByte(s, '\n')
+		part := s
+		if i >= 0 {
+			part = s[:i]
+		}
+		if strings.TrimSpace(part) != "" {
+			rw.lineText = true
+		}
+		if i < 0 {
+			return
+		}
+		rw.prevBlank, rw.lineText = !rw.lineText, false
+		s = s[i+1:]
+	}
+}
+
+// ensureNewline Terminate the current line if output does not end with one
+func (rw *recWriter) ensureNewline() {
+	if rw.n > 0 && rw.last != '\n' {
+		rw.writeString("\n")
+	}
+}
+
+// atBlankLine Report whether output is empty or ends with a blank line
+func (rw *recWriter) atBlankLine() bool {
+	return rw.n == 0 || rw.last == '\n' && rw.prevBlank
+}
+
+func (rw *recWriter) writeRecord(r *Record) {
+	rw.ensureNewline()
+	if rw.n == 0 {
+		rw.writeString(strings.TrimLeft(r.lead, "\n"))
+	} else {
+		rw.writeString(r.lead)
+	}
+	if !rw.atBlankLine() {
+		rw.writeString("\n")
+	}
+
+	for _, f := range r.Fields {
+		rw.ensureNewline()
+		rw.writeField(f)
+	}
+	if r.tail != "" {
+		rw.ensureNewline()
+		rw.writeString(r.tail)
+	}
+}
+
+func (rw *recWriter) writeField(f *Field) {
+	rw.writeString(f.comments)
+	if f.raw != "" && f.Name == f.origName && f.Value == f.origValue {
+		rw.writeString(f.raw)
+		return
+	}
+	rw.writeString(encodeField(f.Name, f.Value))
+}
+
+// encodeField Format a field in rec format, using "+" continuation lines for
+// multi-line values. A line ending with a backslash is followed by an escaped
+// line break and an empty line, since a bare trailing backslash would join it
+// with the next line. Leading blanks of the first line are not preserved, as
+// rec values cannot start with them.
+func encodeField(name, value string) string {
+	lines := strings.Split(value, "\n")
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteString(":")
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteString("+")
+		}
+		if line != "" {
+			sb.WriteString(" ")
+			sb.WriteString(line)
+		}
+		if strings.HasSuffix(line, "\\") {
+			sb.WriteString("\\\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// encodeRecord Format fields as a record in rec format
+func encodeRecord(fields []FieldValue) string {
+	var sb strings.Builder
+	for _, field := range fields {
+		sb.WriteString(encodeField(field.Name, field.text()))
+	}
+	return sb.String()
+}
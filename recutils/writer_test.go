@@ -0,0 +1,127 @@
+// recutils package: Unit and fuzz tests for encoding field values
+package recutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestEncodeField tests the rec text written for field values
+func TestEncodeField(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"John", "Name: John\n"},
+		{"", "Name:\n"},
+		{"a\nb", "Name: a\n+ b\n"},
+		{"a\n\nb", "Name: a\n+\n+ b\n"},
+		{"C:\\", "Name: C:\\\\\n\n"},
+		{"a\\\nb", "Name: a\\\\\n\n+ b\n"},
+		{"a\n+ b\n# c", "Name: a\n+ + b\n+ # c\n"},
+	}
+
+	for _, tt := range tests {
+		if got := encodeField("Name", tt.value); got != tt.want {
+			t.Errorf("encodeField(%q): expected %q, got %q", tt.value, tt.want, got)
+		}
+	}
+}
+
+// FuzzFieldRoundTrip tests that every value written by the writer is parsed
+// back unchanged, apart from the leading blanks of the first line
+func FuzzFieldRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"plain",
+		"two\nlines",
+		"trailing\n",
+		"ends with \\",
+		"\\\n\\",
+		"a\\\\\n+ b",
+		"+ not a field\n# not a comment\n%rec: x",
+		"Name: value\n\nNext: x",
+		"  indented\n  lines  ",
+		"crlf\r\nline",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		db := &Database{}
+		db.RecordSets = []*RecordSet{{Records: []*Record{{Fields: []*Field{
+			NewField("Note", value),
+			NewField("Next", "x"),
+		}}}}}
+		text := db.String()
+
+		parsed, err := Parse(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", text, err)
+		}
+		if len(parsed.RecordSets) != 1 || len(parsed.RecordSets[0].Records) != 1 {
+			t.Fatalf("Expected one record from %q, got %+v", text, parsed.RecordSets)
+		}
+		got := parsed.RecordSets[0].Records[0].Map()
+		want := map[string][]string{
+			"Note": {strings.TrimLeft(value, " \t")},
+			"Next": {"x"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Value %q written as %q: expected %q, got %q", value, text, want, got)
+		}
+	})
+}
+
+// TestInsertEncodedValues tests inserting multi-line values and reading them
+// back through structured queries
+func TestInsertEncodedValues(t *testing.T) {
+	var record string
+	op := NewRecordOperation(WithRunner(RunnerFunc(func(ctx context.Context, argv []string, stdin string) (RunOutput, error) {
+		switch argv[0] {
+		case "recins":
+			record = argv[4]
+		case "recsel":
+			return RunOutput{Stdout: record + "\n"}, nil
+		}
+		return RunOutput{}, nil
+	})))
+	ctx := context.Background()
+	dir := t.TempDir()
+	fields := []FieldValue{
+		{Name: "Path", Value: "C:\\Temp\\"},
+		{Name: "Notes", Value: "first\n+ second\n\nlast\\"},
+	}
+
+	created := filepath.Join(dir, "new.rec")
+	if _, err := op.InsertRecordFields(ctx, created, "Entry", fields); err != nil {
+		t.Fatalf("InsertRecordFields failed: %v", err)
+	}
+	content, _ := os.ReadFile(created)
+	db, err := Parse(strings.NewReader(string(content)))
+	if err != nil {
+		t.Fatalf("Parse failed: %v\n%s", err, content)
+	}
+	want := map[string][]string{
+		"Path":  {"C:\\Temp\\"},
+		"Notes": {"first\n+ second\n\nlast\\"},
+	}
+	if got := db.RecordSet("Entry").Records[0].Map(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q\n%s", want, got, content)
+	}
+
+	if _, err := op.InsertRecordFields(ctx, created, "Entry", fields); err != nil {
+		t.Fatalf("InsertRecordFields failed: %v", err)
+	}
+	result, err := op.QueryRecordsStructured(ctx, created, "", "Entry")
+	if err != nil || !result.Success || len(result.Records) != 1 {
+		t.Fatalf("QueryRecordsStructured failed: %+v, %v", result, err)
+	}
+	if !reflect.DeepEqual(result.Records[0], want) {
+		t.Errorf("Expected %q, got %q", want, result.Records[0])
+	}
+}
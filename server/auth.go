@@ -0,0 +1,363 @@
+// server package: Bearer token authentication of the HTTP transports
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// Scope Permission granted to a token. Each scope includes the ones below
+// it: admin includes write, write includes read.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"  // query tools
+	ScopeWrite Scope = "write" // query and mutation tools
+	ScopeAdmin Scope = "admin" // every tool
+)
+
+// scopeLevels Rank of each scope
+var scopeLevels = map[Scope]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// toolScopes Scope required by each tool. Tools missing here require admin.
+var toolScopes = map[string]Scope{
+	"recutils_query":       ScopeRead,
+	"recutils_aggregate":   ScopeRead,
+	"recutils_info":        ScopeRead,
+	"recutils_schema":      ScopeRead,
+	"recutils_check":       ScopeRead,
+	"recutils_insert":      ScopeWrite,
+	"recutils_update":      ScopeWrite,
+	"recutils_delete":      ScopeWrite,
+	"recutils_recdel":      ScopeWrite,
+	"recutils_recset":      ScopeWrite,
+	"recutils_transaction": ScopeWrite,
+	"recutils_fix":         ScopeWrite,
+	"recutils_create_type": ScopeAdmin,
+	"recutils_alter_type":  ScopeAdmin,
+	"recutils_drop_type":   ScopeAdmin,
+}
+
+// Token Static bearer token and what it may access
+type Token struct {
+	Name   string   `json:"name"`            // shown in the audit log
+	Token  string   `json:"token"`           // secret sent by the client
+	Scopes []Scope  `json:"scopes"`          // granted scopes
+	Paths  []string `json:"paths,omitempty"` // allowed database files, all when empty
+}
+
+// allows Report whether the token has scope or a scope including it
+func (t *Token) allows(scope Scope) bool {
+	for _, granted := range t.Scopes {
+		if scopeLevels[granted] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsPath Report whether the token may access the database file. The file
+// and the token's paths are compared once resolved by resolve, so relative,
+// absolute and symlinked forms of a path name the same file. A path entry
+// matches the file itself, files below it when it is a directory, or files
+// matching it as a filepath.Match pattern. Paths that cannot be resolved
+// match nothing.
+func (t *Token) allowsPath(resolve func(string) (string, error), databaseFile string) bool {
+	if len(t.Paths) == 0 {
+		return true
+	}
+	file, err := resolve(databaseFile)
+	if err != nil {
+		return false
+	}
+	for _, path := range t.Paths {
+		path, err := resolve(path)
+		if err != nil {
+			continue
+		}
+		if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+			return true
+		}
+		if ok, _ := filepath.Match(path, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTokens Parse a JSON list of tokens
+func ParseTokens(data []byte) ([]Token, error) {
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// LoadTokens Read a JSON token file, see ParseTokens
+func LoadTokens(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	return ParseTokens(data)
+}
+
+// maxRequestBody Largest request body the middleware reads to authorize it
+const maxRequestBody = 10 << 20
+
+// Authenticator Check the bearer token and scopes of HTTP requests
+type Authenticator struct {
+	tokens  []Token
+	resolve func(string) (string, error) // canonical form of database paths
+}
+
+// NewAuthenticator Create an authenticator accepting the given tokens
+func NewAuthenticator(tokens []Token) (*Authenticator, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("no tokens configured")
+	}
+	seen := map[string]bool{}
+	for i, token := range tokens {
+		if token.Name == "" {
+			return nil, fmt.Errorf("token %d has no name", i)
+		}
+		if token.Token == "" {
+			return nil, fmt.Errorf("token %s has an empty secret", token.Name)
+		}
+		if seen[token.Token] {
+			return nil, fmt.Errorf("token %s reuses the secret of another token", token.Name)
+		}
+		seen[token.Token] = true
+		if len(token.Scopes) == 0 {
+			return nil, fmt.Errorf("token %s has no scopes", token.Name)
+		}
+		for _, scope := range token.Scopes {
+			if _, ok := scopeLevels[scope]; !ok {
+				return nil, fmt.Errorf("token %s has unknown scope %q, expected read, write or admin", token.Name, scope)
+			}
+		}
+	}
+	return &Authenticator{
+		tokens:  slices.Clone(tokens),
+		resolve: recutils.NewRecordOperation().CanonicalPath,
+	}, nil
+}
+
+// lookup Find the token with the given secret
+func (a *Authenticator) lookup(secret string) *Token {
+	var found *Token
+	// Compare with every token so the time taken does not reveal a match
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(a.tokens[i].Token), []byte(secret)) == 1 {
+			found = &a.tokens[i]
+		}
+	}
+	return found
+}
+
+// bearerSecret Secret of the Authorization header, "" if there is no bearer token
+func bearerSecret(header http.Header) string {
+	scheme, secret, _ := strings.Cut(header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(secret)
+}
+
+// tokenOf Find the token of an MCP request. Only requests of the http
+// transport carry their headers, nil is returned for the others.
+func (a *Authenticator) tokenOf(req mcp.Request) *Token {
+	extra := req.GetExtra()
+	if extra == nil || extra.Header == nil {
+		return nil
+	}
+	if secret := bearerSecret(extra.Header); secret != "" {
+		return a.lookup(secret)
+	}
+	return nil
+}
+
+// allowsPath Report whether token may access the database file. Without a
+// token the file must be allowed to every token.
+func (a *Authenticator) allowsPath(token *Token, databaseFile string) bool {
+	if token != nil {
+		return token.allowsPath(a.resolve, databaseFile)
+	}
+	for i := range a.tokens {
+		if !a.tokens[i].allowsPath(a.resolve, databaseFile) {
+			return false
+		}
+	}
+	return true
+}
+
+// rpcCall JSON-RPC message as far as it is authorized. Params are decoded
+// by authorize depending on the method.
+type rpcCall struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// toolCallParams Authorized params of tools/call
+type toolCallParams struct {
+	Name      string `json:"name"`
+	Arguments struct {
+		DatabaseFile string `json:"database_file"`
+	} `json:"arguments"`
+}
+
+// resourceParams Authorized params of resources/read and resources/subscribe
+type resourceParams struct {
+	URI string `json:"uri"`
+}
+
+// parseCalls Parse a JSON-RPC message or a non-empty batch of them
+func parseCalls(body []byte) ([]rpcCall, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var calls []rpcCall
+		if err := json.Unmarshal(body, &calls); err != nil {
+			return nil, err
+		}
+		if len(calls) == 0 {
+			return nil, errors.New("empty batch")
+		}
+		return calls, nil
+	}
+	var call rpcCall
+	if err := json.Unmarshal(body, &call); err != nil {
+		return nil, err
+	}
+	return []rpcCall{call}, nil
+}
+
+// authorize Return why the token may not make the call, "" if it may. Params
+// that do not decode are refused rather than left to the MCP handler.
+func (a *Authenticator) authorize(t *Token, call rpcCall) string {
+	switch call.Method {
+	case "tools/call":
+		var params toolCallParams
+		if err := json.Unmarshal(call.Params, &params); err != nil {
+			return fmt.Sprintf("invalid %s params: %v", call.Method, err)
+		}
+		return a.authorizeTool(t, params)
+	case "resources/read", "resources/subscribe":
+		if !t.allows(ScopeRead) {
+			return fmt.Sprintf("%s requires scope %s", call.Method, ScopeRead)
+		}
+		var params resourceParams
+		if err := json.Unmarshal(call.Params, &params); err != nil {
+			return fmt.Sprintf("invalid %s params: %v", call.Method, err)
+		}
+		ref, err := parseResourceURI(params.URI)
+		if err != nil {
+			// Not a database, left to the MCP handler to reject
+			return ""
+		}
+		if !a.allowsPath(t, ref.DatabaseFile) {
+			return fmt.Sprintf("database %s is not allowed", ref.DatabaseFile)
+		}
+	}
+	return ""
+}
+
+// authorizeTool Return why the token may not call the tool, "" if it may
+func (a *Authenticator) authorizeTool(t *Token, params toolCallParams) string {
+	tool := params.Name
+	scope, ok := toolScopes[tool]
+	if !ok {
+		scope = ScopeAdmin
+	}
+	if !t.allows(scope) {
+		return fmt.Sprintf("tool %s requires scope %s", tool, scope)
+	}
+	if file := params.Arguments.DatabaseFile; file != "" && !a.allowsPath(t, file) {
+		return fmt.Sprintf("database %s is not allowed", file)
+	}
+	return ""
+}
+
+// Middleware Wrap an MCP handler so that requests without a known bearer
+// token get 401, posted bodies that are not JSON-RPC get 400 and tool calls
+// outside the token's scopes get 403. Rejected
+// requests are written to the audit log.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerSecret(r.Header)
+		if secret == "" {
+			a.reject(w, r, nil, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		token := a.lookup(secret)
+		if token == nil {
+			a.reject(w, r, nil, http.StatusUnauthorized, "unknown bearer token")
+			return
+		}
+
+		if r.Body != nil && r.Method == http.MethodPost {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			r.Body.Close()
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to read request", http.StatusBadRequest)
+				return
+			}
+			calls, err := parseCalls(body)
+			if err != nil {
+				http.Error(w, "request is not JSON-RPC: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, call := range calls {
+				if reason := a.authorize(token, call); reason != "" {
+					a.reject(w, r, token, http.StatusForbidden, reason)
+					return
+				}
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reject Write the audit log entry and the error response of a rejected request
+func (a *Authenticator) reject(w http.ResponseWriter, r *http.Request, token *Token, status int, reason string) {
+	name := "-"
+	if token != nil {
+		name = token.Name
+	}
+	log.Printf("audit: rejected %s %s from %s token=%s status=%d: %s\n",
+		r.Method, r.URL.Path, r.RemoteAddr, name, status, reason)
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="recutils-mcp"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="recutils-mcp", error="insufficient_scope"`)
+	}
+	http.Error(w, reason, status)
+}
+
+// SetAuthenticator Require the bearer tokens of a on the http and sse
+// transports. Token paths are resolved against the server's roots. Must be
+// called before Handler or Serve.
+func (s *MCPServer) SetAuthenticator(a *Authenticator) {
+	a.resolve = s.recutilsOp.CanonicalPath
+	s.auth = a
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+	"github.com/nixihz/recutils-mcp/recutils/rectest"
+)
+
+// testTokens Tokens used by the authentication tests
+var testTokens = []Token{
+	{Name: "reader", Token: "read-secret", Scopes: []Scope{ScopeRead}},
+	{Name: "writer", Token: "write-secret", Scopes: []Scope{ScopeWrite}, Paths: []string{"people.rec", "projects", "logs/*.rec"}},
+	{Name: "admin", Token: "admin-secret", Scopes: []Scope{ScopeAdmin}},
+}
+
+// TestParseTokens tests token file parsing and validation
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens([]byte(`[{"name": "ci", "token": "s3cret", "scopes": ["read"], "paths": ["a.rec"]}]`))
+	if err != nil {
+		t.Fatalf("ParseTokens failed: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "ci" || tokens[0].Scopes[0] != ScopeRead || tokens[0].Paths[0] != "a.rec" {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+	if _, err := ParseTokens([]byte(`{"name": "ci"}`)); err == nil {
+		t.Error("Expected error for a token that is not in a list")
+	}
+
+	invalid := map[string][]Token{
+		"NoTokens":      nil,
+		"NoName":        {{Token: "s", Scopes: []Scope{ScopeRead}}},
+		"EmptySecret":   {{Name: "ci", Scopes: []Scope{ScopeRead}}},
+		"NoScopes":      {{Name: "ci", Token: "s"}},
+		"UnknownScope":  {{Name: "ci", Token: "s", Scopes: []Scope{"root"}}},
+		"ReusedSecrets": {{Name: "a", Token: "s", Scopes: []Scope{ScopeRead}}, {Name: "b", Token: "s", Scopes: []Scope{ScopeRead}}},
+	}
+	for name, tokens := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewAuthenticator(tokens); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+// toolCallBody JSON-RPC body of a tools/call request
+func toolCallBody(tool, databaseFile string) string {
+	return `{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "` + tool +
+		`", "arguments": {"database_file": "` + databaseFile + `"}}}`
+}
+
+// TestAuthMiddleware tests the status codes of authenticated requests
+func TestAuthMiddleware(t *testing.T) {
+	auth, err := NewAuthenticator(testTokens)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	var received string
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+		received = body.String()
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		body   string
+		status int
+	}{
+		{"MissingToken", "", toolCallBody("recutils_query", "people.rec"), http.StatusUnauthorized},
+		{"UnknownToken", "Bearer guess", toolCallBody("recutils_query", "people.rec"), http.StatusUnauthorized},
+		{"BasicAuth", "Basic cmVhZC1zZWNyZXQ=", toolCallBody("recutils_query", "people.rec"), http.StatusUnauthorized},
+		{"ReadQuery", "Bearer read-secret", toolCallBody("recutils_query", "people.rec"), http.StatusOK},
+		{"ReadInsert", "Bearer read-secret", toolCallBody("recutils_insert", "people.rec"), http.StatusForbidden},
+		{"ReadListTools", "Bearer read-secret", `{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`, http.StatusOK},
+		{"WriteInsert", "bearer write-secret", toolCallBody("recutils_insert", "people.rec"), http.StatusOK},
+		{"WriteQueryIncluded", "Bearer write-secret", toolCallBody("recutils_query", "./people.rec"), http.StatusOK},
+		{"WriteDirectory", "Bearer write-secret", toolCallBody("recutils_update", "projects/2026.rec"), http.StatusOK},
+		{"WritePattern", "Bearer write-secret", toolCallBody("recutils_delete", "logs/today.rec"), http.StatusOK},
+		{"WriteOtherPath", "Bearer write-secret", toolCallBody("recutils_query", "secrets.rec"), http.StatusForbidden},
+		{"WriteDirectoryPrefix", "Bearer write-secret", toolCallBody("recutils_query", "projects-old.rec"), http.StatusForbidden},
+		{"WriteUnknownTool", "Bearer write-secret", toolCallBody("recutils_drop_everything", "people.rec"), http.StatusForbidden},
+		{"AdminUnknownTool", "Bearer admin-secret", toolCallBody("recutils_drop_everything", "secrets.rec"), http.StatusOK},
+		{"BatchWithForbiddenCall", "Bearer read-secret",
+			"[" + toolCallBody("recutils_query", "people.rec") + "," + toolCallBody("recutils_delete", "people.rec") + "]",
+			http.StatusForbidden},
+		{"ReadResource", "Bearer read-secret", `{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": {"uri": "rec:///people.rec/Person"}}`, http.StatusOK},
+		{"WriteResourceOtherPath", "Bearer write-secret", `{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": {"uri": "rec:///secrets.rec"}}`, http.StatusForbidden},
+		{"WriteResourceDirectory", "Bearer write-secret", `{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": {"uri": "rec:///projects%2F2026.rec/Task/1"}}`, http.StatusOK},
+		{"NotJSON", "Bearer read-secret", "not json", http.StatusBadRequest},
+		{"MethodNotString", "Bearer read-secret", `{"jsonrpc": "2.0", "id": 1, "method": 5}`, http.StatusBadRequest},
+		{"EmptyBatch", "Bearer read-secret", "[]", http.StatusBadRequest},
+		{"BatchWithMalformedElement", "Bearer read-secret", "[" + toolCallBody("recutils_drop_type", "people.rec") + ", 5]", http.StatusBadRequest},
+		{"ToolCallExtraParam", "Bearer read-secret",
+			`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"uri": 5, "name": "recutils_drop_type", "arguments": {"database_file": "people.rec"}}}`,
+			http.StatusForbidden},
+		{"ToolCallBadDatabaseFile", "Bearer admin-secret",
+			`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "recutils_query", "arguments": {"database_file": 5}}}`,
+			http.StatusForbidden},
+		{"ToolCallBadArguments", "Bearer admin-secret",
+			`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "recutils_query", "arguments": "people.rec"}}`,
+			http.StatusForbidden},
+		{"ResourceBadURI", "Bearer read-secret", `{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": {"uri": 5}}`, http.StatusForbidden},
+		{"Response", "Bearer read-secret", `{"jsonrpc": "2.0", "id": 1, "result": {}}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest(http.MethodPost, HTTPPath, strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				if tt.status != http.StatusBadRequest && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("Expected WWW-Authenticate header")
+				}
+				return
+			}
+			if received != tt.body {
+				t.Errorf("Expected handler to receive the request body, got %q", received)
+			}
+		})
+	}
+}
+
+// TestAuthAuditLog tests that rejected requests are logged
+func TestAuthAuditLog(t *testing.T) {
+	auth, err := NewAuthenticator(testTokens)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	var logged bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	handler := auth.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodPost, HTTPPath, strings.NewReader(toolCallBody("recutils_insert", "people.rec")))
+	req.Header.Set("Authorization", "Bearer read-secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := logged.String()
+	for _, want := range []string{"audit: rejected", "token=reader", "status=403", "recutils_insert"} {
+		if !strings.Contains(entry, want) {
+			t.Errorf("Expected audit entry to contain %q, got %q", want, entry)
+		}
+	}
+	if strings.Contains(entry, "read-secret") {
+		t.Error("Audit entry must not contain the token secret")
+	}
+}
+
+// bearerTransport HTTP transport adding a bearer token to every request
+type bearerTransport struct {
+	token string
+}
+
+func (b bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestAuthenticatedTransport tests an authenticated client over loopback
+func TestAuthenticatedTransport(t *testing.T) {
+	auth, err := NewAuthenticator(testTokens)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	replayer := rectest.NewReplayer()
+	replayer.Add(rectest.Call{
+		Argv:   []string{"recsel", "people.rec"},
+		Output: recutils.RunOutput{Stdout: "Name: John Doe\n"},
+	})
+	s := NewMCPServer(recutils.WithRunner(replayer))
+	s.SetAuthenticator(auth)
+	addr, _, _ := serveLoopback(t, s, TransportHTTP)
+
+	connect := func(token string) (*mcp.ClientSession, error) {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+		return client.Connect(context.Background(), &mcp.StreamableClientTransport{
+			Endpoint:   "http://" + addr + HTTPPath,
+			HTTPClient: &http.Client{Transport: bearerTransport{token: token}},
+		}, nil)
+	}
+
+	if session, err := connect("guess"); err == nil {
+		session.Close()
+		t.Error("Expected connect with an unknown token to fail")
+	}
+
+	session, err := connect("read-secret")
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+
+	result := callTool(t, session, "recutils_query", map[string]any{"database_file": "people.rec"})
+	if !result.Success || result.Output != "Name: John Doe" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	_, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "recutils_insert",
+		Arguments: map[string]any{"database_file": "people.rec", "record_type": "Person", "fields": map[string]any{"Name": "Jane"}},
+	})
+	if err == nil {
+		t.Error("Expected insert with a read token to fail")
+	}
+}
+
+// TestAuthResolvesPaths tests that token paths and requested paths are
+// compared once resolved against the roots
+func TestAuthResolvesPaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "projects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secrets.rec"), []byte("Name: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secrets.rec"), filepath.Join(root, "projects", "link.rec")); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewAuthenticator(testTokens)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	NewMCPServer(recutils.WithRoots(root)).SetAuthenticator(auth)
+	handler := auth.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"Relative", toolCallBody("recutils_query", "projects/2026.rec"), http.StatusOK},
+		{"Absolute", toolCallBody("recutils_query", filepath.Join(root, "projects", "2026.rec")), http.StatusOK},
+		{"AbsoluteOther", toolCallBody("recutils_query", filepath.Join(root, "secrets.rec")), http.StatusForbidden},
+		{"SymlinkOutOfAllowed", toolCallBody("recutils_query", "projects/link.rec"), http.StatusForbidden},
+		{"OutsideRoot", toolCallBody("recutils_query", "../people.rec"), http.StatusForbidden},
+		{"TooLarge", `{"jsonrpc": "2.0", "id": 1, "method": "tools/list", "params": {"pad": "` + strings.Repeat("x", maxRequestBody) + `"}}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, HTTPPath, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer write-secret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// TestAuthListResources tests that resources/list only shows the databases
+// the token may access
+func TestAuthListResources(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"people.rec", "secrets.rec", filepath.Join("projects", "2026.rec")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)
+		if err := os.WriteFile(filepath.Join(root, name), []byte("Name: x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auth, err := NewAuthenticator(testTokens)
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	s := NewMCPServer(recutils.WithRoots(root))
+	s.SetAuthenticator(auth)
+	addr, _, _ := serveLoopback(t, s, TransportHTTP)
+
+	list := func(token string) []string {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+		session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{
+			Endpoint:   "http://" + addr + HTTPPath,
+			HTTPClient: &http.Client{Transport: bearerTransport{token: token}},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Client connect failed: %v", err)
+		}
+		defer session.Close()
+		res, err := session.ListResources(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("ListResources failed: %v", err)
+		}
+		var names []string
+		for _, r := range res.Resources {
+			names = append(names, r.Name)
+		}
+		return names
+	}
+
+	if got := list("read-secret"); len(got) != 3 {
+		t.Errorf("Expected every database for an unrestricted token, got %v", got)
+	}
+	if got, want := list("write-secret"), []string{"people.rec", "projects/2026.rec"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if !auth.allowsPath(nil, "people.rec") || auth.allowsPath(nil, "secrets.rec") {
+		t.Error("Expected unknown callers to see only databases every token may access")
+	}
+}
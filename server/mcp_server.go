@@ -4,8 +4,10 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sync/atomic"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/nixihz/recutils-mcp/recutils"
@@ -13,13 +15,37 @@ import (
 
 // MCPServer MCP server implementation
 type MCPServer struct {
-	recutilsOp *recutils.RecordOperation
+	recutilsOp   *recutils.RecordOperation
+	toolTimeouts map[string]time.Duration // command timeout per tool name
+	inFlight     atomic.Int64             // requests being handled
+	auth         *Authenticator           // bearer tokens of the HTTP transports
 }
 
-// NewMCPServer Create new MCP server
-func NewMCPServer() *MCPServer {
+// NewMCPServer Create new MCP server. The options configure the underlying
+// record operations, e.g. recutils.WithRoots.
+func NewMCPServer(opts ...recutils.Option) *MCPServer {
 	return &MCPServer{
-		recutilsOp: recutils.NewRecordOperation(),
+		recutilsOp:   recutils.NewRecordOperation(opts...),
+		toolTimeouts: map[string]time.Duration{},
+	}
+}
+
+// SetToolTimeout Override the recutils command timeout for one tool, e.g.
+// to give recutils_aggregate more time than the server-wide timeout set
+// with recutils.WithCommandTimeout. Must be called before SetupTools.
+func (s *MCPServer) SetToolTimeout(tool string, timeout time.Duration) {
+	s.toolTimeouts[tool] = timeout
+}
+
+// applyToolTimeouts Middleware that sets the command timeout of the called tool
+func (s *MCPServer) applyToolTimeouts(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if call, ok := req.(*mcp.CallToolRequest); ok && call.Params != nil {
+			if timeout, ok := s.toolTimeouts[call.Params.Name]; ok {
+				ctx = recutils.ContextWithCommandTimeout(ctx, timeout)
+			}
+		}
+		return next(ctx, method, req)
 	}
 }
 
@@ -27,19 +53,34 @@ func NewMCPServer() *MCPServer {
 type QueryArgs struct {
 	DatabaseFile    string `json:"database_file"`
 	QueryExpression string `json:"query_expression,omitempty"`
-	OutputFormat    string `json:"output_format,omitempty"`
+	// OutputFormat is passed to recsel -t; prefer RecordType
+	OutputFormat    string   `json:"output_format,omitempty"`
+	RecordType      string   `json:"record_type,omitempty"`
+	Structured      bool     `json:"structured,omitempty"`
+	Fields          []string `json:"fields,omitempty"`
+	ValuesOnly      bool     `json:"values_only,omitempty"`
+	Sort            []string `json:"sort,omitempty"`
+	GroupBy         []string `json:"group_by,omitempty"`
+	Unique          bool     `json:"unique,omitempty"`
+	Indexes         string   `json:"indexes,omitempty"`
+	Random          int      `json:"random,omitempty"`
+	CaseInsensitive bool     `json:"case_insensitive,omitempty"`
+	Quick           string   `json:"quick,omitempty"`
+	Count           bool     `json:"count,omitempty"`
 }
 
-// InsertArgs Insert parameter structure
+// InsertArgs Insert parameter structure. Fields is either an object, or a
+// list of {name, value} pairs inserted in order.
 type InsertArgs struct {
-	DatabaseFile string                 `json:"database_file"`
-	RecordType   string                 `json:"record_type"`
-	Fields       map[string]interface{} `json:"fields"`
+	DatabaseFile string      `json:"database_file"`
+	RecordType   string      `json:"record_type"`
+	Fields       interface{} `json:"fields"`
 }
 
 // UpdateArgs Update parameter structure
 type UpdateArgs struct {
 	DatabaseFile    string                 `json:"database_file"`
+	RecordType      string                 `json:"record_type,omitempty"`
 	QueryExpression string                 `json:"query_expression"`
 	Fields          map[string]interface{} `json:"fields"`
 }
@@ -47,9 +88,122 @@ type UpdateArgs struct {
 // DeleteArgs Delete parameter structure
 type DeleteArgs struct {
 	DatabaseFile    string `json:"database_file"`
+	RecordType      string `json:"record_type,omitempty"`
 	QueryExpression string `json:"query_expression"`
 }
 
+// SelectionArgs Record selection parameters shared by recdel and recset
+type SelectionArgs struct {
+	RecordType      string `json:"record_type,omitempty"`
+	QueryExpression string `json:"query_expression,omitempty"`
+	Quick           string `json:"quick,omitempty"`
+	Indexes         string `json:"indexes,omitempty"`
+	Random          int    `json:"random,omitempty"`
+	CaseInsensitive bool   `json:"case_insensitive,omitempty"`
+}
+
+// RecdelArgs recdel parameter structure
+type RecdelArgs struct {
+	DatabaseFile string `json:"database_file"`
+	SelectionArgs
+	Comment bool `json:"comment,omitempty"`
+	Force   bool `json:"force,omitempty"`
+}
+
+// RecsetArgs recset parameter structure
+type RecsetArgs struct {
+	DatabaseFile string `json:"database_file"`
+	SelectionArgs
+	Fields string `json:"fields"`
+	Action string `json:"action"`
+	Value  string `json:"value,omitempty"`
+	Force  bool   `json:"force,omitempty"`
+}
+
+func (a QueryArgs) options() recutils.QueryOptions {
+	recordType := a.RecordType
+	if recordType == "" {
+		recordType = a.OutputFormat
+	}
+	return recutils.QueryOptions{
+		Selection: recutils.Selection{
+			RecordType:      recordType,
+			Expression:      a.QueryExpression,
+			Quick:           a.Quick,
+			Indexes:         a.Indexes,
+			Random:          a.Random,
+			CaseInsensitive: a.CaseInsensitive,
+		},
+		Fields:     a.Fields,
+		ValuesOnly: a.ValuesOnly,
+		Sort:       a.Sort,
+		GroupBy:    a.GroupBy,
+		Unique:     a.Unique,
+		Count:      a.Count,
+		Structured: a.Structured,
+	}
+}
+
+func (a SelectionArgs) selection() recutils.Selection {
+	return recutils.Selection{
+		RecordType:      a.RecordType,
+		Expression:      a.QueryExpression,
+		Quick:           a.Quick,
+		Indexes:         a.Indexes,
+		Random:          a.Random,
+		CaseInsensitive: a.CaseInsensitive,
+	}
+}
+
+// AggregateArgs Aggregate parameter structure
+type AggregateArgs struct {
+	DatabaseFile    string                   `json:"database_file"`
+	RecordType      string                   `json:"record_type,omitempty"`
+	QueryExpression string                   `json:"query_expression,omitempty"`
+	GroupBy         []string                 `json:"group_by,omitempty"`
+	Aggregates      []recutils.AggregateSpec `json:"aggregates"`
+}
+
+// TransactionArgs Transaction parameter structure
+type TransactionArgs struct {
+	DatabaseFile string            `json:"database_file"`
+	Steps        []recutils.TxStep `json:"steps"`
+}
+
+// SchemaArgs Schema parameter structure
+type SchemaArgs struct {
+	DatabaseFile string `json:"database_file"`
+	RecordType   string `json:"record_type,omitempty"`
+}
+
+// TypeArgs Create and alter type parameter structure
+type TypeArgs struct {
+	DatabaseFile string                      `json:"database_file"`
+	RecordType   string                      `json:"record_type"`
+	Changes      []recutils.DescriptorChange `json:"changes"`
+}
+
+// DropTypeArgs Drop type parameter structure
+type DropTypeArgs struct {
+	DatabaseFile string `json:"database_file"`
+	RecordType   string `json:"record_type"`
+	Force        bool   `json:"force,omitempty"`
+}
+
+// FixArgs recfix parameter structure
+type FixArgs struct {
+	DatabaseFile string `json:"database_file"`
+	Operation    string `json:"operation,omitempty"`
+	Password     string `json:"password,omitempty"`
+	Force        bool   `json:"force,omitempty"`
+	NoExternal   bool   `json:"no_external,omitempty"`
+}
+
+// CheckArgs Integrity check parameter structure
+type CheckArgs struct {
+	DatabaseFile string `json:"database_file"`
+}
+
 // InfoArgs Info parameter structure
 type InfoArgs struct {
 	DatabaseFile string `json:"database_file"`
@@ -57,64 +211,98 @@ type InfoArgs struct {
 
 // SetupTools Setup MCP tools
 func (s *MCPServer) SetupTools(server *mcp.Server) error {
+	if len(s.toolTimeouts) > 0 {
+		server.AddReceivingMiddleware(s.applyToolTimeouts)
+	}
+
 	// Add tool: Query records
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "recutils_query",
-		Description: "Query records in recutils database",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, args QueryArgs) (*mcp.CallToolResult, any, error) {
-		result, err := s.recutilsOp.QueryRecords(ctx, args.DatabaseFile, args.QueryExpression, args.OutputFormat)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
-				},
-			}, nil, nil
-		}
-
-		resultJSON, err := json.Marshal(result)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error marshaling result: %v", err)},
-				},
-			}, nil, nil
-		}
+		Name: "recutils_query",
+		Description: "Query records in recutils database. Set structured to get the records as a list of " +
+			"objects mapping each field name to its list of values instead of rec text. " +
+			"Records are selected with at most one of query_expression, quick (substring search), " +
+			"indexes (e.g. \"0,2-4\") or random (count). fields projects the output (values_only drops field names), " +
+			"sort and group_by take field names, unique removes duplicated fields and count returns the number of matches.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args QueryArgs) (*mcp.CallToolResult, *recutils.Result, error) {
+		return structuredResult(s.recutilsOp.QueryRecordsWithOptions(ctx, args.DatabaseFile, args.options()))
+	})
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(resultJSON)},
+	// Add tool: Aggregate report
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_aggregate",
+		Description: "Compute aggregates over records, e.g. total hours per project. " +
+			"aggregates is a list of {function, field, alias} where function is Count, Sum, Avg, Min or Max. " +
+			"Records can be filtered with query_expression and grouped by the group_by fields. " +
+			"Returns a table with typed columns and one row per group.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args AggregateArgs) (*mcp.CallToolResult, *recutils.Result, error) {
+		return structuredResult(s.recutilsOp.Aggregate(ctx, args.DatabaseFile, recutils.AggregateOptions{
+			Selection: recutils.Selection{
+				RecordType: args.RecordType,
+				Expression: args.QueryExpression,
 			},
-		}, nil, nil
+			GroupBy:    args.GroupBy,
+			Aggregates: args.Aggregates,
+		}))
 	})
 
+	// Add tool: Get database info
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "recutils_info",
+		Description: "Get recutils database info",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args InfoArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.GetDatabaseInfo(ctx, args.DatabaseFile))
+	})
+
+	// Add tool: Schema of record sets
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_schema",
+		Description: "Get the parsed record descriptors of a database, or of one record_type: " +
+			"key, mandatory, allowed, prohibit, unique, auto, sort, confidential, size, constraints and doc, " +
+			"the type of each field (kind int, bool, real, range with min/max, size, line, regexp, date, " +
+			"enum with values, field, email, uuid or rec with the referenced record type) and typedefs. " +
+			"Use it to construct valid inserts.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args SchemaArgs) (*mcp.CallToolResult, *recutils.Result, error) {
+		return structuredResult(s.recutilsOp.GetSchema(ctx, args.DatabaseFile, args.RecordType))
+	})
+
+	// Add tool: Integrity check
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_check",
+		Description: "Check a database with recfix --check without changing it. " +
+			"Integrity errors are returned as diagnostics with file, line, record_type, field and message.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args CheckArgs) (*mcp.CallToolResult, *recutils.Result, error) {
+		return structuredResult(s.recutilsOp.Check(ctx, args.DatabaseFile))
+	})
+
+	// Mutation tools are not offered at all in read-only mode
+	if s.recutilsOp.ReadOnly() {
+		return nil
+	}
+	s.setupMutationTools(server)
+
+	return nil
+}
+
+// setupMutationTools Setup the MCP tools that modify databases
+func (s *MCPServer) setupMutationTools(server *mcp.Server) {
 	// Add tool: Insert records
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "recutils_insert",
-		Description: "Insert new record into recutils database",
+		Name: "recutils_insert",
+		Description: "Insert new record into recutils database. fields is an object, where an array value " +
+			"inserts one field per element and fields are ordered as the record descriptor declares them, " +
+			"or a list of {name, value} pairs inserted in the given order, where a name may repeat.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args InsertArgs) (*mcp.CallToolResult, any, error) {
-		result, err := s.recutilsOp.InsertRecord(ctx, args.DatabaseFile, args.RecordType, args.Fields)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
-				},
-			}, nil, nil
+		switch fields := args.Fields.(type) {
+		case map[string]interface{}:
+			return toolResult(s.recutilsOp.InsertRecord(ctx, args.DatabaseFile, args.RecordType, fields))
+		case []interface{}:
+			values, err := recutils.ParseFieldValues(fields)
+			if err != nil {
+				return toolResult(nil, err)
+			}
+			return toolResult(s.recutilsOp.InsertRecordFields(ctx, args.DatabaseFile, args.RecordType, values))
 		}
-
-		resultJSON, err := json.Marshal(result)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error marshaling result: %v", err)},
-				},
-			}, nil, nil
-		}
-
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(resultJSON)},
-			},
-		}, nil, nil
+		return toolResult(nil, errors.New("fields must be an object or a list of {name, value} pairs"))
 	})
 
 	// Add tool: Update records
@@ -122,29 +310,7 @@ func (s *MCPServer) SetupTools(server *mcp.Server) error {
 		Name:        "recutils_update",
 		Description: "Update records in recutils database",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args UpdateArgs) (*mcp.CallToolResult, any, error) {
-		result, err := s.recutilsOp.UpdateRecords(ctx, args.DatabaseFile, args.QueryExpression, args.Fields)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
-				},
-			}, nil, nil
-		}
-
-		resultJSON, err := json.Marshal(result)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error marshaling result: %v", err)},
-				},
-			}, nil, nil
-		}
-
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(resultJSON)},
-			},
-		}, nil, nil
+		return toolResult(s.recutilsOp.UpdateRecords(ctx, args.DatabaseFile, args.RecordType, args.QueryExpression, args.Fields))
 	})
 
 	// Add tool: Delete records
@@ -152,78 +318,166 @@ func (s *MCPServer) SetupTools(server *mcp.Server) error {
 		Name:        "recutils_delete",
 		Description: "Delete records from recutils database",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args DeleteArgs) (*mcp.CallToolResult, any, error) {
-		result, err := s.recutilsOp.DeleteRecords(ctx, args.DatabaseFile, args.QueryExpression)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
-				},
-			}, nil, nil
-		}
+		return toolResult(s.recutilsOp.DeleteRecords(ctx, args.DatabaseFile, args.RecordType, args.QueryExpression))
+	})
 
-		resultJSON, err := json.Marshal(result)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error marshaling result: %v", err)},
-				},
-			}, nil, nil
-		}
+	// Add tool: Delete records with recdel
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_recdel",
+		Description: "Delete or comment out records with recdel. Select records with exactly one of " +
+			"query_expression, quick (substring search), indexes (e.g. \"0,2-4\") or random (count). " +
+			"Set comment to comment records out instead of deleting them, and force to ignore integrity checks.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args RecdelArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.RemoveRecords(ctx, args.DatabaseFile, recutils.DeleteOptions{
+			Selection: args.selection(),
+			Comment:   args.Comment,
+			Force:     args.Force,
+		}))
+	})
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(resultJSON)},
-			},
-		}, nil, nil
+	// Add tool: Modify fields with recset
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_recset",
+		Description: "Modify fields of records with recset. fields is a field expression such as \"Email\" or \"Email[1]\". " +
+			"action is one of set, add, set_add, rename (value is the new name), delete or comment. " +
+			"Records are selected with at most one of query_expression, quick, indexes or random; all records of the type otherwise.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args RecsetArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.SetFields(ctx, args.DatabaseFile, recutils.SetOptions{
+			Selection: args.selection(),
+			Fields:    args.Fields,
+			Action:    recutils.SetAction(args.Action),
+			Value:     args.Value,
+			Force:     args.Force,
+		}))
 	})
 
-	// Add tool: Get database info
+	// Add tool: Transaction
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "recutils_info",
-		Description: "Get recutils database info",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, args InfoArgs) (*mcp.CallToolResult, any, error) {
-		result, err := s.recutilsOp.GetDatabaseInfo(ctx, args.DatabaseFile)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
-				},
-			}, nil, nil
-		}
+		Name: "recutils_transaction",
+		Description: "Apply several insert, update and delete steps to one database as a single unit. " +
+			"Each step has an operation (insert, update or delete), a record_type, a query_expression for " +
+			"update and delete, and fields for insert and update. The database is only changed if every step " +
+			"succeeds; otherwise nothing is written and the failing step is reported.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args TransactionArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.RunTransaction(ctx, args.DatabaseFile, args.Steps))
+	})
 
-		resultJSON, err := json.Marshal(result)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Error marshaling result: %v", err)},
-				},
-			}, nil, nil
-		}
+	// Add tool: Integrity check and repair
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_fix",
+		Description: "Check or repair a database with recfix. operation is check (default), sort, auto " +
+			"(fill in missing %auto fields), encrypt or decrypt (confidential fields, both need password). " +
+			"Integrity errors are returned as diagnostics with file, line, record_type, field and message.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args FixArgs) (*mcp.CallToolResult, *recutils.Result, error) {
+		return structuredResult(s.recutilsOp.Fix(ctx, args.DatabaseFile, recutils.FixOptions{
+			Operation:  recutils.FixOperation(args.Operation),
+			Password:   args.Password,
+			Force:      args.Force,
+			NoExternal: args.NoExternal,
+		}))
+	})
+
+	// Add tool: Create record type
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_create_type",
+		Description: "Create a record type with a new descriptor, creating the database if needed. " +
+			"changes is a list of {action, field, value} applied to the descriptor, where action is set, add or remove " +
+			"and field is a special field such as %key, %mandatory, %type, %typedef, %auto, %sort or %doc. " +
+			"The result is checked with recfix before it is written.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args TypeArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.CreateType(ctx, args.DatabaseFile, args.RecordType, args.Changes))
+	})
+
+	// Add tool: Alter record type
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "recutils_alter_type",
+		Description: "Change the descriptor of an existing record type. changes is a list of {action, field, value}: " +
+			"set replaces every field of the name, add adds another one, and remove deletes them all, or with a value " +
+			"only that value (e.g. one field of %mandatory or %type, or one %typedef by name). " +
+			"The result is checked with recfix before it is written.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args TypeArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.AlterType(ctx, args.DatabaseFile, args.RecordType, args.Changes))
+	})
 
+	// Add tool: Drop record type
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "recutils_drop_type",
+		Description: "Remove a record type with its descriptor. A type that still has records is only dropped with force, which deletes them too.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args DropTypeArgs) (*mcp.CallToolResult, any, error) {
+		return toolResult(s.recutilsOp.DropType(ctx, args.DatabaseFile, args.RecordType, args.Force))
+	})
+}
+
+// toolResult Convert a recutils result into a tool result with JSON text content
+func toolResult(result *recutils.Result, err error) (*mcp.CallToolResult, any, error) {
+	// Rejected field values are returned as a result, so callers see which
+	// fields to correct
+	var verr *recutils.ValidationError
+	if err != nil && !errors.As(err, &verr) {
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(resultJSON)},
+				&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
 			},
 		}, nil, nil
-	})
+	}
 
-	return nil
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Error marshaling result: %v", err)},
+			},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(resultJSON)},
+		},
+	}, nil, nil
 }
 
-// Run Run MCP server
-func (s *MCPServer) Run(ctx context.Context) error {
-	// Create server
+// structuredResult Return a recutils result as structured tool output. The
+// SDK also renders it as JSON text content for clients without structured
+// content support.
+func structuredResult(result *recutils.Result, err error) (*mcp.CallToolResult, *recutils.Result, error) {
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Error: %v", err)},
+			},
+		}, &recutils.Result{Success: false, Error: err.Error()}, nil
+	}
+	return nil, result, nil
+}
+
+// newServer Create the MCP server with all tools and resources set up
+func (s *MCPServer) newServer() (*mcp.Server, error) {
+	watcher := newResourceWatcher(s.recutilsOp)
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "recutils-mcp",
 		Version: "1.0.0",
-	}, nil)
+	}, &mcp.ServerOptions{
+		SubscribeHandler:   watcher.subscribe,
+		UnsubscribeHandler: watcher.unsubscribe,
+	})
+	watcher.server = server
+	server.AddReceivingMiddleware(s.trackRequests)
 
 	// Add tools
 	if err := s.SetupTools(server); err != nil {
-		return fmt.Errorf("failed to setup tools: %w", err)
+		return nil, fmt.Errorf("failed to setup tools: %w", err)
 	}
+	s.SetupResources(server)
+	return server, nil
+}
 
-	log.Println("Starting Recutils MCP Server...")
+// Run Run MCP server on stdin and stdout
+func (s *MCPServer) Run(ctx context.Context) error {
+	server, err := s.newServer()
+	if err != nil {
+		return err
+	}
 
 	// Create stdio transport and run server
 	transport := &mcp.StdioTransport{}
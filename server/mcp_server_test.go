@@ -2,11 +2,18 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/nixihz/recutils-mcp/recutils"
+	"github.com/nixihz/recutils-mcp/recutils/rectest"
 )
 
 func TestMCPServer(t *testing.T) {
@@ -171,7 +178,7 @@ func TestMCPServerIntegration(t *testing.T) {
 		t.Logf("Query result: %+v", queryResult)
 
 		// 3. Update record
-		updateResult, err := recOp.UpdateRecords(ctx, tmpFile.Name(), "Name = 'Jane Smith'", map[string]interface{}{
+		updateResult, err := recOp.UpdateRecords(ctx, tmpFile.Name(), "Person", "Name = 'Jane Smith'", map[string]interface{}{
 			"Age": 31,
 		})
 		if err != nil {
@@ -233,6 +240,175 @@ func TestSetupTools(t *testing.T) {
 	})
 }
 
+// connectTestClient Connect an in-memory MCP client to a server set up with s
+func connectTestClient(t *testing.T, s *MCPServer) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "recutils-mcp", Version: "test"}, nil)
+	if err := s.SetupTools(server); err != nil {
+		t.Fatalf("SetupTools failed: %v", err)
+	}
+	s.SetupResources(server)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("Server connect failed: %v", err)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// callTool Call a tool and decode its JSON text result
+func callTool(t *testing.T, session *mcp.ClientSession, name string, args any) recutils.Result {
+	t.Helper()
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("CallTool %s failed: %v", name, err)
+	}
+	if len(res.Content) == 0 {
+		t.Fatalf("CallTool %s returned no content", name)
+	}
+	text, ok := res.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("CallTool %s returned %T, want text content", name, res.Content[0])
+	}
+
+	var result recutils.Result
+	if err := json.Unmarshal([]byte(text.Text), &result); err != nil {
+		t.Fatalf("CallTool %s returned non-JSON text %q", name, text.Text)
+	}
+	return result
+}
+
+// TestToolRegistration tests the tools exposed over MCP
+func TestToolRegistration(t *testing.T) {
+	session := connectTestClient(t, NewMCPServer())
+
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+
+	want := []string{
+		"recutils_aggregate",
+		"recutils_alter_type",
+		"recutils_check",
+		"recutils_create_type",
+		"recutils_delete",
+		"recutils_drop_type",
+		"recutils_fix",
+		"recutils_info",
+		"recutils_insert",
+		"recutils_query",
+		"recutils_recdel",
+		"recutils_recset",
+		"recutils_schema",
+		"recutils_transaction",
+		"recutils_update",
+	}
+	if len(names) != len(want) {
+		t.Fatalf("Expected tools %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Expected tools %v, got %v", want, names)
+			break
+		}
+	}
+
+	t.Run("RecdelRequiresSelection", func(t *testing.T) {
+		result := callTool(t, session, "recutils_recdel", map[string]any{
+			"database_file": "test.rec",
+			"record_type":   "Person",
+		})
+		if result.Success {
+			t.Error("recdel without selection should fail")
+		}
+	})
+
+	t.Run("RecsetRejectsUnknownAction", func(t *testing.T) {
+		result := callTool(t, session, "recutils_recset", map[string]any{
+			"database_file": "test.rec",
+			"fields":        "Name",
+			"action":        "replace",
+		})
+		if result.Success {
+			t.Error("recset with unknown action should fail")
+		}
+	})
+}
+
+// TestQueryToolStructuredContent tests the structured output of recutils_query
+func TestQueryToolStructuredContent(t *testing.T) {
+	session := connectTestClient(t, NewMCPServer())
+	ctx := context.Background()
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	for _, tool := range tools.Tools {
+		if tool.Name == "recutils_query" && tool.OutputSchema == nil {
+			t.Error("recutils_query should declare an output schema")
+		}
+	}
+
+	if _, err := exec.LookPath("recsel"); err != nil {
+		t.Skip("recutils not installed, skipping structured query call")
+	}
+
+	tmpFile := filepath.Join(t.TempDir(), "structured.rec")
+	testData := `%rec: Person
+
+Name: John Doe
+Email: john@example.com
+Email: jd@example.com
+`
+	if err := os.WriteFile(tmpFile, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to write test data: %v", err)
+	}
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name: "recutils_query",
+		Arguments: map[string]any{
+			"database_file": tmpFile,
+			"structured":    true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	raw, err := json.Marshal(res.StructuredContent)
+	if err != nil {
+		t.Fatalf("Failed to marshal structured content: %v", err)
+	}
+	var result recutils.Result
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("Structured content is not a result: %s", raw)
+	}
+	if !result.Success || len(result.Records) != 1 {
+		t.Fatalf("Unexpected structured result: %s", raw)
+	}
+	if emails := result.Records[0]["Email"]; len(emails) != 2 {
+		t.Errorf("Repeated fields not preserved: %v", emails)
+	}
+}
+
 // TestDeleteRecordsOperation tests the delete operation
 func TestDeleteRecordsOperation(t *testing.T) {
 	ctx := context.Background()
@@ -270,7 +446,7 @@ City: Chicago
 		}
 		tmpFile.Close()
 
-		result, err := recOp.DeleteRecords(ctx, tmpFile.Name(), "Name = 'Jane Smith'")
+		result, err := recOp.DeleteRecords(ctx, tmpFile.Name(), "Person", "Name = 'Jane Smith'")
 		if err != nil {
 			t.Errorf("Delete failed: %v", err)
 			return
@@ -309,7 +485,7 @@ City: Chicago
 		}
 		tmpFile2.Close()
 
-		result, err := recOp.DeleteRecords(ctx, tmpFile2.Name(), "Age < 29")
+		result, err := recOp.DeleteRecords(ctx, tmpFile2.Name(), "Person", "Age < 29")
 		if err != nil {
 			t.Errorf("Delete failed: %v", err)
 			return
@@ -347,7 +523,7 @@ City: Chicago
 		}
 		tmpFile.Close()
 
-		result, err := recOp.DeleteRecords(ctx, tmpFile.Name(), "Name = 'NonExistent'")
+		result, err := recOp.DeleteRecords(ctx, tmpFile.Name(), "Person", "Name = 'NonExistent'")
 		if err != nil {
 			t.Errorf("Delete failed: %v", err)
 			return
@@ -365,7 +541,7 @@ City: Chicago
 	})
 
 	t.Run("DeleteFromNonExistentFile", func(t *testing.T) {
-		result, err := recOp.DeleteRecords(ctx, "/nonexistent/file.rec", "Name = 'Test'")
+		result, err := recOp.DeleteRecords(ctx, "/nonexistent/file.rec", "Person", "Name = 'Test'")
 		// DeleteRecords returns error for non-existent file
 		if err == nil {
 			t.Error("Expected error for non-existent file")
@@ -410,7 +586,7 @@ City: Los Angeles
 		}
 		tmpFile.Close()
 
-		result, err := recOp.UpdateRecords(ctx, tmpFile.Name(), "Name = 'John Doe'", map[string]interface{}{
+		result, err := recOp.UpdateRecords(ctx, tmpFile.Name(), "Person", "Name = 'John Doe'", map[string]interface{}{
 			"Age": 26,
 		})
 		if err != nil {
@@ -446,7 +622,7 @@ City: Los Angeles
 		}
 		tmpFile2.Close()
 
-		result, err := recOp.UpdateRecords(ctx, tmpFile2.Name(), "Name = 'Jane Smith'", map[string]interface{}{
+		result, err := recOp.UpdateRecords(ctx, tmpFile2.Name(), "Person", "Name = 'Jane Smith'", map[string]interface{}{
 			"Age":  31,
 			"City": "San Francisco",
 		})
@@ -487,7 +663,7 @@ City: Los Angeles
 		}
 		tmpFile3.Close()
 
-		result, err := recOp.UpdateRecords(ctx, tmpFile3.Name(), "Name = 'John Doe'", map[string]interface{}{
+		result, err := recOp.UpdateRecords(ctx, tmpFile3.Name(), "Person", "Name = 'John Doe'", map[string]interface{}{
 			"Email": "john.doe@example.com",
 		})
 		if err != nil {
@@ -523,7 +699,7 @@ City: Los Angeles
 		}
 		tmpFile.Close()
 
-		result, err := recOp.UpdateRecords(ctx, tmpFile.Name(), "Name = 'NonExistent'", map[string]interface{}{
+		result, err := recOp.UpdateRecords(ctx, tmpFile.Name(), "Person", "Name = 'NonExistent'", map[string]interface{}{
 			"Age": 99,
 		})
 		if err != nil {
@@ -721,3 +897,248 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+// TestRootRestriction tests that tools reject database files outside the roots
+func TestRootRestriction(t *testing.T) {
+	session := connectTestClient(t, NewMCPServer(recutils.WithRoots(t.TempDir())))
+	target := filepath.Join(t.TempDir(), "escape.rec")
+
+	calls := map[string]map[string]any{
+		"recutils_insert": {"database_file": target, "record_type": "Person", "fields": map[string]any{"Name": "x"}},
+		"recutils_query":  {"database_file": target, "structured": true},
+		"recutils_info":   {"database_file": target},
+	}
+	for name, args := range calls {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool %s failed: %v", name, err)
+		}
+		text, ok := res.Content[0].(*mcp.TextContent)
+		if !ok || !strings.Contains(text.Text, recutils.ErrOutsideRoot.Error()) {
+			t.Errorf("%s: expected root violation, got %+v", name, res.Content[0])
+		}
+	}
+
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("File outside root was created")
+	}
+}
+
+// TestReadOnlyToolRegistration tests that read-only servers only offer query tools
+func TestReadOnlyToolRegistration(t *testing.T) {
+	session := connectTestClient(t, NewMCPServer(recutils.WithReadOnly()))
+
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+
+	want := []string{"recutils_aggregate", "recutils_check", "recutils_info", "recutils_query", "recutils_schema"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected tools %v, got %v", want, names)
+	}
+
+	_, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "recutils_delete",
+		Arguments: map[string]any{"database_file": "test.rec", "query_expression": "Name = 'x'"},
+	})
+	if err == nil {
+		t.Error("Expected recutils_delete to be unavailable")
+	}
+}
+
+// TestCheckTool tests integrity checks on a read-only server
+func TestCheckTool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.rec")
+	if err := os.WriteFile(path, []byte("%rec: Person\n%mandatory: Name\n\nId: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var commands [][]string
+	runner := recutils.RunnerFunc(func(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+		commands = append(commands, argv)
+		return recutils.RunOutput{Stderr: path + ": 4: error: mandatory field 'Name' not found in record\n", ExitCode: 1}, nil
+	})
+	session := connectTestClient(t, NewMCPServer(recutils.WithReadOnly(), recutils.WithRunner(runner)))
+
+	result := callTool(t, session, "recutils_check", map[string]any{"database_file": path})
+	if result.Success || len(result.Diagnostics) != 1 || result.Diagnostics[0].RecordType != "Person" {
+		t.Errorf("Expected one Person diagnostic, got %+v", result)
+	}
+	if len(commands) != 1 || commands[0][0] != "recfix" || commands[0][1] != "--check" {
+		t.Errorf("Expected recfix --check, got %v", commands)
+	}
+}
+
+// TestToolTimeout tests per-tool command timeouts
+func TestToolTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available, skipping test")
+	}
+
+	// Slow stand-ins for the recutils binaries
+	binDir := t.TempDir()
+	for _, name := range []string{"recsel", "recinf"} {
+		script := "#!/bin/sh\nexec sleep 0.5\n"
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dbFile := filepath.Join(t.TempDir(), "slow.rec")
+	if err := os.WriteFile(dbFile, []byte("Name: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewMCPServer(recutils.WithCommandTimeout(time.Minute))
+	s.SetToolTimeout("recutils_query", 100*time.Millisecond)
+	session := connectTestClient(t, s)
+
+	result := callTool(t, session, "recutils_query", map[string]any{"database_file": dbFile})
+	if result.Success || !result.TimedOut {
+		t.Errorf("Expected recutils_query to time out, got %+v", result)
+	}
+
+	result = callTool(t, session, "recutils_info", map[string]any{"database_file": dbFile})
+	if !result.Success || result.TimedOut {
+		t.Errorf("Expected recutils_info to use the server timeout, got %+v", result)
+	}
+}
+
+// TestQueryToolReplayed tests a tool call end to end without recutils installed
+func TestQueryToolReplayed(t *testing.T) {
+	replayer := rectest.NewReplayer(rectest.Call{
+		Argv:   []string{"recsel", "-t", "Person", "-e", "Age > 30", "people.rec"},
+		Output: recutils.RunOutput{Stdout: "Name: John Doe\nAge: 35\n"},
+	})
+	session := connectTestClient(t, NewMCPServer(recutils.WithRunner(replayer)))
+
+	result := callTool(t, session, "recutils_query", map[string]any{
+		"database_file":    "people.rec",
+		"record_type":      "Person",
+		"query_expression": "Age > 30",
+		"structured":       true,
+	})
+	if !result.Success || len(result.Records) != 1 || result.Records[0]["Name"][0] != "John Doe" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+// TestSchemaTool tests the structured output of recutils_schema
+func TestSchemaTool(t *testing.T) {
+	session := connectTestClient(t, NewMCPServer())
+	tmpFile := filepath.Join(t.TempDir(), "schema.rec")
+	testData := `%rec: Person
+%key: Id
+%type: Age range 0 120
+
+Id: 1
+`
+	if err := os.WriteFile(tmpFile, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to write test data: %v", err)
+	}
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "recutils_schema",
+		Arguments: map[string]any{"database_file": tmpFile},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	raw, err := json.Marshal(res.StructuredContent)
+	if err != nil {
+		t.Fatalf("Failed to marshal structured content: %v", err)
+	}
+	var result recutils.Result
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("Structured content is not a result: %s", raw)
+	}
+	if !result.Success || len(result.Schema) != 1 || result.Schema[0].Key != "Id" {
+		t.Fatalf("Unexpected structured result: %s", raw)
+	}
+	if age := result.Schema[0].Types["Age"]; age == nil || age.Kind != "range" || *age.Max != 120 {
+		t.Errorf("Unexpected Age type: %s", raw)
+	}
+}
+
+// TestTypeTools tests creating, altering and dropping a record type through
+// the tools, with recfix accepting every change
+func TestTypeTools(t *testing.T) {
+	recfix := recutils.RunnerFunc(func(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+		return recutils.RunOutput{}, nil
+	})
+	session := connectTestClient(t, NewMCPServer(recutils.WithRunner(recfix)))
+	tmpFile := filepath.Join(t.TempDir(), "types.rec")
+
+	result := callTool(t, session, "recutils_create_type", map[string]any{
+		"database_file": tmpFile,
+		"record_type":   "Person",
+		"changes":       []map[string]any{{"action": "set", "field": "%key", "value": "Id"}},
+	})
+	if !result.Success {
+		t.Fatalf("recutils_create_type failed: %+v", result)
+	}
+	result = callTool(t, session, "recutils_alter_type", map[string]any{
+		"database_file": tmpFile,
+		"record_type":   "Person",
+		"changes":       []map[string]any{{"action": "add", "field": "%type", "value": "Id int"}},
+	})
+	if !result.Success {
+		t.Fatalf("recutils_alter_type failed: %+v", result)
+	}
+	content, _ := os.ReadFile(tmpFile)
+	if want := "%rec: Person\n%key: Id\n%type: Id int\n"; string(content) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, content)
+	}
+	if result := callTool(t, session, "recutils_drop_type", map[string]any{"database_file": tmpFile, "record_type": "Person"}); !result.Success {
+		t.Errorf("recutils_drop_type failed: %+v", result)
+	}
+}
+
+// TestInsertToolFields tests ordered field lists and rejected values through
+// recutils_insert
+func TestInsertToolFields(t *testing.T) {
+	var record string
+	runner := recutils.RunnerFunc(func(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+		if argv[0] == "recins" {
+			record = argv[4]
+		}
+		return recutils.RunOutput{}, nil
+	})
+	session := connectTestClient(t, NewMCPServer(recutils.WithRunner(runner)))
+	tmpFile := filepath.Join(t.TempDir(), "people.rec")
+	if err := os.WriteFile(tmpFile, []byte("%rec: Person\n%type: Age int\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := callTool(t, session, "recutils_insert", map[string]any{
+		"database_file": tmpFile,
+		"record_type":   "Person",
+		"fields": []map[string]any{
+			{"name": "Name", "value": "John Doe"},
+			{"name": "Email", "value": "john@example.com"},
+			{"name": "Email", "value": "jd@example.com"},
+		},
+	})
+	if !result.Success {
+		t.Fatalf("recutils_insert failed: %+v", result)
+	}
+	if want := "Name: John Doe\nEmail: john@example.com\nEmail: jd@example.com"; record != want {
+		t.Errorf("Expected recins record:\n%s\ngot:\n%s", want, record)
+	}
+
+	result = callTool(t, session, "recutils_insert", map[string]any{
+		"database_file": tmpFile,
+		"record_type":   "Person",
+		"fields":        map[string]any{"Name": "Jane", "Age": "old"},
+	})
+	if result.Success || len(result.FieldErrors) != 1 || result.FieldErrors[0].Field != "Age" {
+		t.Errorf("Expected the Age field to be rejected, got %+v", result)
+	}
+}
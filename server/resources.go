@@ -0,0 +1,182 @@
+// server package: Database files as MCP resources
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+const (
+	// ResourceScheme URI scheme of database resources, e.g. rec:///people.rec
+	ResourceScheme = "rec"
+	// RecMIMEType MIME type of rec text
+	RecMIMEType = "text/x-rec"
+)
+
+// resourceTemplates Templates of the database, record set and record resources
+var resourceTemplates = []*mcp.ResourceTemplate{
+	{
+		Name:        "database",
+		Description: "A recutils database file, as listed by resources/list",
+		URITemplate: "rec:///{+path}",
+		MIMEType:    RecMIMEType,
+	},
+	{
+		Name:        "record_set",
+		Description: "The descriptor and records of one record type of a database",
+		URITemplate: "rec:///{file}/{type}",
+		MIMEType:    RecMIMEType,
+	},
+	{
+		Name:        "record",
+		Description: "The record of a type whose %key field has the given value",
+		URITemplate: "rec:///{file}/{type}/{key}",
+		MIMEType:    RecMIMEType,
+	},
+}
+
+// DatabaseURI Resource URI of a database path as accepted by the tools
+func DatabaseURI(databaseFile string) string {
+	segments := strings.Split(filepath.ToSlash(databaseFile), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return ResourceScheme + ":///" + strings.Join(segments, "/")
+}
+
+// resourceRef Database, record set or record named by a resource URI
+type resourceRef struct {
+	DatabaseFile string
+	RecordType   string // empty for the whole database
+	Key          string // empty for the whole record set
+}
+
+// parseResourceURI Split a resource URI into its database path, record type
+// and key. The database path ends at the first segment with the database
+// extension, or at the end of the URI; segments may be percent-encoded, so
+// rec:///projects%2F2026.rec/Task and rec:///projects/2026.rec/Task are the
+// same record set.
+func parseResourceURI(uri string) (resourceRef, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return resourceRef{}, err
+	}
+	if u.Scheme != ResourceScheme || u.Host != "" || u.Opaque != "" || !strings.HasPrefix(u.EscapedPath(), "/") {
+		return resourceRef{}, fmt.Errorf("not a %s:/// URI: %s", ResourceScheme, uri)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		if segments[i], err = url.PathUnescape(segment); err != nil {
+			return resourceRef{}, err
+		}
+	}
+	end := len(segments)
+	for i, segment := range segments {
+		if strings.HasSuffix(segment, recutils.DatabaseExt) {
+			end = i + 1
+			break
+		}
+	}
+
+	ref := resourceRef{DatabaseFile: filepath.FromSlash(strings.Join(segments[:end], "/"))}
+	rest := segments[end:]
+	if ref.DatabaseFile == "" || len(rest) > 2 {
+		return resourceRef{}, fmt.Errorf("invalid resource URI: %s", uri)
+	}
+	if len(rest) > 0 {
+		ref.RecordType = rest[0]
+	}
+	if len(rest) > 1 {
+		ref.Key = rest[1]
+	}
+	return ref, nil
+}
+
+// SetupResources Setup the database resources. Every database below the
+// roots is listed; the templates read databases, record sets and records.
+func (s *MCPServer) SetupResources(server *mcp.Server) {
+	server.AddReceivingMiddleware(s.listResources)
+	for _, template := range resourceTemplates {
+		server.AddResourceTemplate(template, s.readResource)
+	}
+}
+
+// listResources Middleware that answers resources/list with the databases
+// currently found below the roots. With authentication only the databases
+// the caller's token may access are listed; when the token is not known, as
+// on the sse transport, only those every token may access.
+func (s *MCPServer) listResources(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "resources/list" {
+			return next(ctx, method, req)
+		}
+		databases, err := s.recutilsOp.ListDatabases()
+		if err != nil {
+			return nil, err
+		}
+		result := &mcp.ListResourcesResult{Resources: []*mcp.Resource{}}
+		var token *Token
+		if s.auth != nil {
+			token = s.auth.tokenOf(req)
+		}
+		for _, databaseFile := range databases {
+			if s.auth != nil && !s.auth.allowsPath(token, databaseFile) {
+				continue
+			}
+			result.Resources = append(result.Resources, &mcp.Resource{
+				Name:     filepath.ToSlash(databaseFile),
+				URI:      DatabaseURI(databaseFile),
+				MIMEType: RecMIMEType,
+			})
+		}
+		return result, nil
+	}
+}
+
+// readResource Read a database, record set or record as rec text
+func (s *MCPServer) readResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.recutilsOp.ReadDatabase(ctx, ref.DatabaseFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text := db.String()
+	if ref.RecordType != "" {
+		rs := db.RecordSet(ref.RecordType)
+		if rs == nil {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		text = (&recutils.Database{RecordSets: []*recutils.RecordSet{rs}}).String()
+		if ref.Key != "" {
+			r := rs.Lookup(ref.Key)
+			if r == nil {
+				return nil, mcp.ResourceNotFoundError(uri)
+			}
+			text = r.String()
+		}
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: uri, MIMEType: RecMIMEType, Text: text},
+		},
+	}, nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// testResourceContent Database used by the resource tests
+const testResourceContent = `%rec: Person
+%key: Id
+
+Id: 1
+Name: John Doe
+
+Id: 2
+Name: Jane Doe
+
+%rec: Project
+
+Title: Garden
+`
+
+// resourceTestSession Connect a client to a server rooted at a directory
+// holding people.rec and projects/2026.rec
+func resourceTestSession(t *testing.T) *mcp.ClientSession {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "people.rec"), []byte(testResourceContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "projects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "projects", "2026.rec"), []byte("Title: Garden\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return connectTestClient(t, NewMCPServer(recutils.WithRoots(root)))
+}
+
+// TestParseResourceURI tests splitting resource URIs
+func TestParseResourceURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want resourceRef
+	}{
+		{"rec:///people.rec", resourceRef{DatabaseFile: "people.rec"}},
+		{"rec:///people.rec/Person", resourceRef{DatabaseFile: "people.rec", RecordType: "Person"}},
+		{"rec:///people.rec/Person/1", resourceRef{DatabaseFile: "people.rec", RecordType: "Person", Key: "1"}},
+		{"rec:///projects/2026.rec/Task", resourceRef{DatabaseFile: filepath.Join("projects", "2026.rec"), RecordType: "Task"}},
+		{"rec:///projects%2F2026.rec/Task/a%2Fb", resourceRef{DatabaseFile: filepath.Join("projects", "2026.rec"), RecordType: "Task", Key: "a/b"}},
+		{"rec:////srv/data/people.rec", resourceRef{DatabaseFile: filepath.FromSlash("/srv/data/people.rec")}},
+		{"rec:///My%20Data/db", resourceRef{DatabaseFile: filepath.Join("My Data", "db")}},
+	}
+	for _, tt := range tests {
+		got, err := parseResourceURI(tt.uri)
+		if err != nil || got != tt.want {
+			t.Errorf("parseResourceURI(%q) = %+v, %v, want %+v", tt.uri, got, err, tt.want)
+		}
+	}
+
+	for _, uri := range []string{"file:///people.rec", "rec://host/people.rec", "rec:people.rec", "rec:///", "rec:///people.rec/Person/1/extra"} {
+		if _, err := parseResourceURI(uri); err == nil {
+			t.Errorf("Expected error for %q", uri)
+		}
+	}
+
+	if uri := DatabaseURI(filepath.Join("My Data", "people.rec")); uri != "rec:///My%20Data/people.rec" {
+		t.Errorf("Unexpected URI %q", uri)
+	}
+}
+
+// TestListResources tests that every database below the root is listed
+func TestListResources(t *testing.T) {
+	session := resourceTestSession(t)
+
+	res, err := session.ListResources(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListResources failed: %v", err)
+	}
+	var uris []string
+	for _, r := range res.Resources {
+		uris = append(uris, r.URI)
+		if r.MIMEType != RecMIMEType {
+			t.Errorf("Unexpected MIME type %q of %s", r.MIMEType, r.URI)
+		}
+	}
+	if len(uris) != 2 || uris[0] != "rec:///people.rec" || uris[1] != "rec:///projects/2026.rec" {
+		t.Errorf("Unexpected resources %v", uris)
+	}
+
+	templates, err := session.ListResourceTemplates(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListResourceTemplates failed: %v", err)
+	}
+	if len(templates.ResourceTemplates) != len(resourceTemplates) {
+		t.Errorf("Expected %d templates, got %d", len(resourceTemplates), len(templates.ResourceTemplates))
+	}
+}
+
+// TestReadResource tests reading databases, record sets and records
+func TestReadResource(t *testing.T) {
+	session := resourceTestSession(t)
+
+	tests := map[string]string{
+		"rec:///people.rec":          testResourceContent,
+		"rec:///projects/2026.rec":   "Title: Garden\n",
+		"rec:///people.rec/Person":   "%rec: Person\n%key: Id\n\nId: 1\nName: John Doe\n\nId: 2\nName: Jane Doe\n",
+		"rec:///people.rec/Project":  "%rec: Project\n\nTitle: Garden\n",
+		"rec:///people.rec/Person/2": "Id: 2\nName: Jane Doe\n",
+		"rec:///projects%2F2026.rec": "Title: Garden\n",
+	}
+	for uri, want := range tests {
+		res, err := session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: uri})
+		if err != nil {
+			t.Errorf("ReadResource %s failed: %v", uri, err)
+			continue
+		}
+		if len(res.Contents) != 1 || res.Contents[0].Text != want || res.Contents[0].MIMEType != RecMIMEType {
+			t.Errorf("ReadResource %s returned %+v, want %q", uri, res.Contents[0], want)
+		}
+	}
+
+	for _, uri := range []string{
+		"rec:///missing.rec",
+		"rec:///people.rec/Task",
+		"rec:///people.rec/Person/3",
+		"rec:///people.rec/Project/Garden", // no %key
+		"rec:///../outside.rec",
+	} {
+		if _, err := session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: uri}); err == nil {
+			t.Errorf("Expected ReadResource %s to fail", uri)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// server package: Streamable HTTP and SSE transports
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Transport Way clients connect to the server
+type Transport string
+
+const (
+	TransportStdio Transport = "stdio" // a single client on stdin and stdout
+	TransportHTTP  Transport = "http"  // streamable HTTP at HTTPPath
+	TransportSSE   Transport = "sse"   // server-sent events at SSEPath
+)
+
+const (
+	// HTTPPath Endpoint of the streamable HTTP transport
+	HTTPPath = "/mcp"
+	// SSEPath Endpoint of the SSE transport
+	SSEPath = "/sse"
+)
+
+// ShutdownTimeout Time running requests get to finish once the server is
+// shut down
+var ShutdownTimeout = 10 * time.Second
+
+// idlePollInterval Interval to check for running requests during shutdown
+const idlePollInterval = 10 * time.Millisecond
+
+// streamDrainDelay Time clients get to read the last responses before their
+// event streams end. Some clients drop events still queued when the stream
+// closes.
+const streamDrainDelay = 100 * time.Millisecond
+
+// ParseTransport Parse a transport name
+func ParseTransport(name string) (Transport, error) {
+	switch t := Transport(name); t {
+	case TransportStdio, TransportHTTP, TransportSSE:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown transport %q, expected stdio, http or sse", name)
+}
+
+// trackRequests Middleware that counts the requests being handled
+func (s *MCPServer) trackRequests(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		return next(ctx, method, req)
+	}
+}
+
+// waitIdle Wait until no request is being handled or ctx is done
+func (s *MCPServer) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for s.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// sseStreams Calls accepted over SSE whose response has not been written to
+// the event stream yet, by session ID. The SSE transport accepts a call before
+// handling it and answers on the stream, so shutdown has to wait for the
+// stream write rather than for the POST.
+type sseStreams struct {
+	s       *MCPServer
+	mu      sync.Mutex
+	pending map[string]int64
+}
+
+// trackSSE Middleware that counts SSE calls as running until their response
+// is written to the event stream
+func (s *MCPServer) trackSSE(next http.Handler) http.Handler {
+	streams := &sseStreams{s: s, pending: make(map[string]int64)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			stream := &sseStream{ResponseWriter: w, streams: streams}
+			defer streams.end(stream)
+			next.ServeHTTP(stream, r)
+		case http.MethodPost:
+			streams.post(w, r, next)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// add Count n calls of a session, if its stream is open
+func (t *sseStreams) add(sessionID string, n int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[sessionID]; !ok {
+		return false
+	}
+	t.pending[sessionID] += n
+	t.s.inFlight.Add(n)
+	return true
+}
+
+// post Forward a message posted to a session, counting it when it is a call
+func (t *sseStreams) post(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	sessionID := r.URL.Query().Get("sessionid")
+	if !isCall(body) || !t.add(sessionID, 1) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	status := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(status, r)
+	if status.status != http.StatusAccepted {
+		t.add(sessionID, -1)
+	}
+}
+
+// open Start counting the calls of a session
+func (t *sseStreams) open(sessionID string, stream *sseStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stream.sessionID = sessionID
+	t.pending[sessionID] = 0
+}
+
+// end Stop counting the calls of a closed stream, their responses are lost
+func (t *sseStreams) end(stream *sseStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stream.sessionID == "" {
+		return
+	}
+	t.s.inFlight.Add(-t.pending[stream.sessionID])
+	delete(t.pending, stream.sessionID)
+}
+
+// sseStream Event stream of one SSE session. The session ID is taken from
+// the endpoint event and every response event finishes a call.
+type sseStream struct {
+	http.ResponseWriter
+	streams   *sseStreams
+	sessionID string
+}
+
+func (s *sseStream) Write(p []byte) (int, error) {
+	name, data := parseEvent(p)
+	if name == "endpoint" && s.sessionID == "" {
+		// Register before the client learns the endpoint and starts posting
+		if u, err := url.Parse(data); err == nil {
+			s.streams.open(u.Query().Get("sessionid"), s)
+		}
+	}
+	n, err := s.ResponseWriter.Write(p)
+	if err == nil && name == "message" && isResponse([]byte(data)) {
+		s.streams.add(s.sessionID, -1)
+	}
+	return n, err
+}
+
+func (s *sseStream) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// parseEvent Name and data of a server-sent event written in one piece
+func parseEvent(p []byte) (name, data string) {
+	for _, line := range strings.Split(string(p), "\n") {
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			name = v
+		} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	return name, data
+}
+
+// jsonrpcMessage Fields telling JSON-RPC calls and responses apart
+type jsonrpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// isCall Whether body is a JSON-RPC request expecting a response
+func isCall(body []byte) bool {
+	var msg jsonrpcMessage
+	return json.Unmarshal(body, &msg) == nil && msg.Method != "" && len(msg.ID) > 0
+}
+
+// isResponse Whether data is a JSON-RPC response
+func isResponse(data []byte) bool {
+	var msg jsonrpcMessage
+	return json.Unmarshal(data, &msg) == nil && msg.Method == "" && len(msg.ID) > 0
+}
+
+// statusWriter Records the status code of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Handler HTTP handler serving the http or sse transport. All clients share
+// one MCP server. Requests are authenticated when SetAuthenticator was called.
+func (s *MCPServer) Handler(transport Transport) (http.Handler, error) {
+	server, err := s.newServer()
+	if err != nil {
+		return nil, err
+	}
+	getServer := func(*http.Request) *mcp.Server { return server }
+
+	mux := http.NewServeMux()
+	switch transport {
+	case TransportHTTP:
+		mux.Handle(HTTPPath, mcp.NewStreamableHTTPHandler(getServer, nil))
+	case TransportSSE:
+		mux.Handle(SSEPath, s.trackSSE(mcp.NewSSEHandler(getServer, nil)))
+	default:
+		return nil, fmt.Errorf("transport %q is not served over HTTP", transport)
+	}
+	if s.auth != nil {
+		return s.auth.Middleware(mux), nil
+	}
+	return mux, nil
+}
+
+// Serve Serve the http or sse transport on ln until ctx is done. Shutdown
+// stops accepting connections, waits up to ShutdownTimeout for running
+// requests and then closes the open event streams.
+func (s *MCPServer) Serve(ctx context.Context, ln net.Listener, transport Transport) error {
+	handler, err := s.Handler(transport)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	// Event streams live as long as this context rather than the caller's,
+	// so running requests can still deliver their results during shutdown
+	streamCtx, closeStreams := context.WithCancel(context.WithoutCancel(ctx))
+	defer closeStreams()
+
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return streamCtx },
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(ln)
+	}()
+	log.Printf("Serving %s transport on %s\n", transport, ln.Addr())
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server run failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Waiting for running requests...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- httpServer.Shutdown(shutdownCtx)
+	}()
+	if err := s.waitIdle(shutdownCtx); err != nil {
+		log.Println("Shutdown timed out with requests still running")
+	} else {
+		select {
+		case <-time.After(streamDrainDelay):
+		case <-shutdownCtx.Done():
+		}
+	}
+	closeStreams()
+
+	if err := <-shutdownErr; err != nil {
+		httpServer.Close()
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server run failed: %w", err)
+	}
+	return nil
+}
+
+// ListenAndServe Listen on the TCP address addr and serve the http or sse
+// transport until ctx is done
+func (s *MCPServer) ListenAndServe(ctx context.Context, transport Transport, addr string) error {
+	if transport != TransportHTTP && transport != TransportSSE {
+		return fmt.Errorf("transport %q is not served over HTTP", transport)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	return s.Serve(ctx, ln, transport)
+}
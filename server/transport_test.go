@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+	"github.com/nixihz/recutils-mcp/recutils/rectest"
+)
+
+// TestParseTransport tests transport name parsing
+func TestParseTransport(t *testing.T) {
+	for _, name := range []string{"stdio", "http", "sse"} {
+		if transport, err := ParseTransport(name); err != nil || string(transport) != name {
+			t.Errorf("ParseTransport(%q) = %q, %v", name, transport, err)
+		}
+	}
+	if _, err := ParseTransport("websocket"); err == nil {
+		t.Error("Expected error for unknown transport")
+	}
+}
+
+// serveLoopback Serve s on a loopback listener until the returned cancel
+// function is called. The channel receives the result of Serve.
+func serveLoopback(t *testing.T, s *MCPServer, transport Transport) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, ln, transport)
+	}()
+	t.Cleanup(cancel)
+	return ln.Addr().String(), cancel, done
+}
+
+// connectHTTPClient Connect an MCP client over the http or sse transport
+func connectHTTPClient(t *testing.T, transport Transport, addr string) *mcp.ClientSession {
+	t.Helper()
+
+	var clientTransport mcp.Transport
+	switch transport {
+	case TransportHTTP:
+		clientTransport = &mcp.StreamableClientTransport{Endpoint: "http://" + addr + HTTPPath}
+	case TransportSSE:
+		clientTransport = &mcp.SSEClientTransport{Endpoint: "http://" + addr + SSEPath}
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(context.Background(), clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// waitServe Wait for Serve to return
+func waitServe(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after shutdown")
+		return nil
+	}
+}
+
+// TestHTTPTransports tests tool calls over the network transports
+func TestHTTPTransports(t *testing.T) {
+	for _, transport := range []Transport{TransportHTTP, TransportSSE} {
+		t.Run(string(transport), func(t *testing.T) {
+			replayer := rectest.NewReplayer()
+			for i := 0; i < 2; i++ {
+				replayer.Add(rectest.Call{
+					Argv:   []string{"recsel", "people.rec"},
+					Output: recutils.RunOutput{Stdout: "Name: John Doe\n"},
+				})
+			}
+			addr, cancel, done := serveLoopback(t, NewMCPServer(recutils.WithRunner(replayer)), transport)
+
+			// Clients share the server
+			for _, session := range []*mcp.ClientSession{
+				connectHTTPClient(t, transport, addr),
+				connectHTTPClient(t, transport, addr),
+			} {
+				result := callTool(t, session, "recutils_query", map[string]any{"database_file": "people.rec"})
+				if !result.Success || result.Output != "Name: John Doe" {
+					t.Errorf("Unexpected result %+v", result)
+				}
+			}
+
+			cancel()
+			if err := waitServe(t, done); err != nil {
+				t.Errorf("Serve failed: %v", err)
+			}
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Close()
+				t.Error("Expected listener to be closed after shutdown")
+			}
+		})
+	}
+}
+
+// TestGracefulShutdown tests that running requests finish during shutdown
+func TestGracefulShutdown(t *testing.T) {
+	for _, transport := range []Transport{TransportHTTP, TransportSSE} {
+		t.Run(string(transport), func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			runner := recutils.RunnerFunc(func(ctx context.Context, argv []string, stdin string) (recutils.RunOutput, error) {
+				close(started)
+				<-release
+				return recutils.RunOutput{Stdout: "Name: John Doe\n"}, nil
+			})
+			addr, cancel, done := serveLoopback(t, NewMCPServer(recutils.WithRunner(runner)), transport)
+			session := connectHTTPClient(t, transport, addr)
+
+			type callResult struct {
+				res *mcp.CallToolResult
+				err error
+			}
+			results := make(chan callResult, 1)
+			go func() {
+				res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+					Name:      "recutils_query",
+					Arguments: map[string]any{"database_file": "people.rec"},
+				})
+				results <- callResult{res, err}
+			}()
+			<-started
+			cancel()
+
+			select {
+			case err := <-done:
+				t.Fatalf("Serve returned with a running request: %v", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			close(release)
+			select {
+			case result := <-results:
+				if result.err != nil {
+					t.Errorf("Expected running request to finish, got %v", result.err)
+				} else if result.res.IsError {
+					t.Errorf("Expected running request to succeed, got %+v", result.res.Content)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the running request")
+			}
+			if err := waitServe(t, done); err != nil {
+				t.Errorf("Serve failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestListenAndServeStdio tests that stdio is not served over HTTP
+func TestListenAndServeStdio(t *testing.T) {
+	if err := NewMCPServer().ListenAndServe(context.Background(), TransportStdio, "127.0.0.1:0"); err == nil {
+		t.Error("Expected error for stdio transport")
+	}
+}
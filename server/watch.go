@@ -0,0 +1,239 @@
+// server package: Resource change notifications via file watching
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// WatchDebounce Quiet time after the last change of a subscribed database
+// before subscribers are notified, so a burst of writes sends one
+// notification
+var WatchDebounce = 100 * time.Millisecond
+
+// resourceWatcher Watch the database files of subscribed resources and send
+// resources/updated notifications when they change. Directories are watched
+// rather than files, so saves that rename a new file over the database are
+// seen like in-place writes. The fsnotify watcher only runs while something
+// is subscribed.
+type resourceWatcher struct {
+	op     *recutils.RecordOperation
+	server *mcp.Server
+
+	mu    sync.Mutex
+	fsw   *fsnotify.Watcher
+	files map[string]*watchedFile // by absolute database path
+	dirs  map[string]int          // watched directories, by number of watched files
+}
+
+// watchedFile Subscriptions to the resources of one database file
+type watchedFile struct {
+	subscribers map[string]map[*mcp.ServerSession]bool // sessions by resource URI
+	timer       *time.Timer                            // pending notification
+}
+
+// newResourceWatcher Create a watcher for the resources of op. The server
+// must be set before the first subscription.
+func newResourceWatcher(op *recutils.RecordOperation) *resourceWatcher {
+	return &resourceWatcher{
+		op:    op,
+		files: map[string]*watchedFile{},
+		dirs:  map[string]int{},
+	}
+}
+
+// databasePath Absolute path of the database file of a resource URI
+func (w *resourceWatcher) databasePath(uri string) (string, error) {
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return "", err
+	}
+	path, err := w.op.ResolvePath(ref.DatabaseFile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// subscribe Start watching the database of a resource for the session
+func (w *resourceWatcher) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	path, err := w.databasePath(req.Params.URI)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pruneLocked()
+
+	f, ok := w.files[path]
+	if !ok {
+		if err := w.watchDirLocked(filepath.Dir(path)); err != nil {
+			return err
+		}
+		f = &watchedFile{subscribers: map[string]map[*mcp.ServerSession]bool{}}
+		w.files[path] = f
+	}
+	if f.subscribers[req.Params.URI] == nil {
+		f.subscribers[req.Params.URI] = map[*mcp.ServerSession]bool{}
+	}
+	f.subscribers[req.Params.URI][req.Session] = true
+	return nil
+}
+
+// unsubscribe Stop watching the database of a resource for the session
+func (w *resourceWatcher) unsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	path, err := w.databasePath(req.Params.URI)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if f, ok := w.files[path]; ok {
+		delete(f.subscribers[req.Params.URI], req.Session)
+		if len(f.subscribers[req.Params.URI]) == 0 {
+			delete(f.subscribers, req.Params.URI)
+		}
+		if len(f.subscribers) == 0 {
+			w.unwatchLocked(path)
+		}
+	}
+	w.pruneLocked()
+	return nil
+}
+
+// watchDirLocked Watch a directory, starting the fsnotify watcher if needed
+func (w *resourceWatcher) watchDirLocked(dir string) error {
+	if w.fsw == nil {
+		fsw, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to start file watcher: %w", err)
+		}
+		w.fsw = fsw
+		go w.run(fsw)
+	}
+	if w.dirs[dir] == 0 {
+		if err := w.fsw.Add(dir); err != nil {
+			if len(w.files) == 0 {
+				w.fsw.Close()
+				w.fsw = nil
+			}
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	w.dirs[dir]++
+	return nil
+}
+
+// unwatchLocked Stop watching a database file, and its directory and the
+// fsnotify watcher when nothing else needs them
+func (w *resourceWatcher) unwatchLocked(path string) {
+	if f := w.files[path]; f.timer != nil {
+		f.timer.Stop()
+	}
+	delete(w.files, path)
+
+	dir := filepath.Dir(path)
+	w.dirs[dir]--
+	if w.dirs[dir] == 0 {
+		delete(w.dirs, dir)
+		w.fsw.Remove(dir)
+	}
+	if len(w.files) == 0 {
+		w.fsw.Close()
+		w.fsw = nil
+	}
+}
+
+// pruneLocked Drop the subscriptions of sessions that have disconnected,
+// which do not unsubscribe
+func (w *resourceWatcher) pruneLocked() {
+	live := map[*mcp.ServerSession]bool{}
+	for session := range w.server.Sessions() {
+		live[session] = true
+	}
+	for path, f := range w.files {
+		for uri, sessions := range f.subscribers {
+			for session := range sessions {
+				if !live[session] {
+					delete(sessions, session)
+				}
+			}
+			if len(sessions) == 0 {
+				delete(f.subscribers, uri)
+			}
+		}
+		if len(f.subscribers) == 0 {
+			w.unwatchLocked(path)
+		}
+	}
+}
+
+// run Handle the events of fsw until it is closed
+func (w *resourceWatcher) run(fsw *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			w.changed(event)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v\n", err)
+		}
+	}
+}
+
+// changed Schedule the notification of a changed database, restarting the
+// debounce timer of a pending one
+func (w *resourceWatcher) changed(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+	path := filepath.Clean(event.Name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, ok := w.files[path]
+	if !ok {
+		return
+	}
+	if f.timer != nil {
+		f.timer.Reset(WatchDebounce)
+		return
+	}
+	f.timer = time.AfterFunc(WatchDebounce, func() { w.notify(path) })
+}
+
+// notify Send resources/updated for every subscribed resource of a database
+func (w *resourceWatcher) notify(path string) {
+	w.mu.Lock()
+	w.pruneLocked()
+	f, ok := w.files[path]
+	if !ok {
+		w.mu.Unlock()
+		return
+	}
+	f.timer = nil
+	var uris []string
+	for uri := range f.subscribers {
+		uris = append(uris, uri)
+	}
+	w.mu.Unlock()
+
+	for _, uri := range uris {
+		w.server.ResourceUpdated(context.Background(), &mcp.ResourceUpdatedNotificationParams{URI: uri})
+	}
+}
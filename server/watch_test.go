@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/nixihz/recutils-mcp/recutils"
+)
+
+// connectSubscriber Connect an in-memory client to the full server of s. The
+// channel receives the URI of every resources/updated notification.
+func connectSubscriber(t *testing.T, s *MCPServer) (*mcp.ClientSession, <-chan string) {
+	t.Helper()
+	ctx := context.Background()
+
+	server, err := s.newServer()
+	if err != nil {
+		t.Fatalf("newServer failed: %v", err)
+	}
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("Server connect failed: %v", err)
+	}
+
+	updated := make(chan string, 16)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	})
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session, updated
+}
+
+// expectUpdate Wait for a notification of uri
+func expectUpdate(t *testing.T, updated <-chan string, uri string) {
+	t.Helper()
+	select {
+	case got := <-updated:
+		if got != uri {
+			t.Errorf("Expected update of %s, got %s", uri, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No update of %s", uri)
+	}
+}
+
+// expectNoUpdate Check that no notification arrives for a while
+func expectNoUpdate(t *testing.T, updated <-chan string) {
+	t.Helper()
+	select {
+	case got := <-updated:
+		t.Errorf("Unexpected update of %s", got)
+	case <-time.After(3 * WatchDebounce):
+	}
+}
+
+// TestResourceSubscription tests resources/updated notifications for
+// changes of subscribed databases
+func TestResourceSubscription(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "people.rec")
+	if err := os.WriteFile(path, []byte(testResourceContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "other.rec"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	session, updated := connectSubscriber(t, NewMCPServer(recutils.WithRoots(root)))
+	ctx := context.Background()
+
+	const uri = "rec:///people.rec/Person"
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	t.Run("InPlaceWrite", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte(testResourceContent+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		expectUpdate(t, updated, uri)
+		expectNoUpdate(t, updated)
+	})
+
+	t.Run("RenameSave", func(t *testing.T) {
+		tmp := filepath.Join(root, ".people.rec.swp")
+		if err := os.WriteFile(tmp, []byte(testResourceContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		expectUpdate(t, updated, uri)
+		expectNoUpdate(t, updated)
+
+		// The replaced file is still watched
+		if err := os.WriteFile(path, []byte(testResourceContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		expectUpdate(t, updated, uri)
+	})
+
+	t.Run("BurstIsDebounced", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			f.WriteString("\n")
+		}
+		f.Close()
+		expectUpdate(t, updated, uri)
+		expectNoUpdate(t, updated)
+	})
+
+	t.Run("OtherFile", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(root, "other.rec"), []byte("Name: x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		expectNoUpdate(t, updated)
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		if err := session.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: uri}); err != nil {
+			t.Fatalf("Unsubscribe failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(testResourceContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		expectNoUpdate(t, updated)
+	})
+
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "rec:///../outside.rec"}); err == nil {
+		t.Error("Expected subscribing outside the root to fail")
+	}
+}